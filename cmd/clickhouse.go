@@ -5,7 +5,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/clickhouse"
 	"github.com/freshworks/load-generator/internal/loadgen"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -37,17 +36,15 @@ lg clickhouse --requestrate 10 --duration 10s --query 'SELECT count() FROM table
 			args = []string{o.DSN}
 		}
 
+		o := clickhouse.NewOptions()
+		o.DSN = args[0]
+		o.Query = clickhouseQuery
+
 		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := clickhouse.NewOptions()
-			o.DSN = args[0]
-			o.Query = clickhouseQuery
-			return clickhouse.NewGenerator(id, *o, cmd.Context(), requestrate, s)
+			return clickhouse.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
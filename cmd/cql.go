@@ -7,7 +7,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/cql"
 	"github.com/freshworks/load-generator/internal/loadgen"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/spf13/cobra"
 )
@@ -26,27 +25,27 @@ lg cql --requestrate 1 cql --disable-peers-lookup --username foo --password 1234
 `,
 	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := cql.NewOptions()
-			o.Targets = args
-			o.Query = cqlQuery
-			o.Plaintext = cqlPlaintext
-			o.AstraSecureBundle = cqlAstraSecureBundle
-			o.Username = cqlUsername
-			o.Password = cqlPassword
-			o.DisablePeersLookup = cqlDisablePeersLookup
-			o.Consistency = cqlConsistencyLevel
-			o.ConnectTimeout = cqlConnectTimeout
-			o.WriteTimeout = cqlWriteTimeout
-			o.EnableCompression = cqlEnableCompression
-			o.NumConnsPerHost = cqlNumConnsPerHost
-			o.NumRetries = cqlNumRetries
-			o.HostSelectionPolicy = cqlHostSelectionPolicy
-			o.DCName = cqlDataCenterName
-			o.WriteCoalesceWaitTime = cqlWriteCoalesceWaitTime
-			o.Keyspace = cqlKeyspace
-			o.TrackMetricsPerNode = cqlTrackMetricsPerNode
+		o := cql.NewOptions()
+		o.Targets = args
+		o.Query = cqlQuery
+		o.Plaintext = cqlPlaintext
+		o.AstraSecureBundle = cqlAstraSecureBundle
+		o.Username = cqlUsername
+		o.Password = cqlPassword
+		o.DisablePeersLookup = cqlDisablePeersLookup
+		o.Consistency = cqlConsistencyLevel
+		o.ConnectTimeout = cqlConnectTimeout
+		o.WriteTimeout = cqlWriteTimeout
+		o.EnableCompression = cqlEnableCompression
+		o.NumConnsPerHost = cqlNumConnsPerHost
+		o.NumRetries = cqlNumRetries
+		o.HostSelectionPolicy = cqlHostSelectionPolicy
+		o.DCName = cqlDataCenterName
+		o.WriteCoalesceWaitTime = cqlWriteCoalesceWaitTime
+		o.Keyspace = cqlKeyspace
+		o.TrackMetricsPerNode = cqlTrackMetricsPerNode
 
+		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
 			return cql.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
@@ -54,10 +53,7 @@ lg cql --requestrate 1 cql --disable-peers-lookup --username foo --password 1234
 			return fmt.Errorf("target cassandra server was not given")
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
@@ -8,7 +8,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/grpc"
 	"github.com/freshworks/load-generator/internal/loadgen"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/spf13/cobra"
 )
@@ -42,30 +41,30 @@ Make the gRPC call but use custom DNS resolver
 `,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		o := grpc.NewOptions()
+		if len(args) > 0 {
+			o.Target = args[0]
+		}
+		o.Method = grpcMethod
+		o.Headers = grpcHeaders
+		o.Authority = grpcAuthority
+		o.Data = grpcData
+		o.Proto = grpcProtoFiles
+		o.ImportPath = grpcProtoImportPaths
+		o.Plaintext = grpcPlaintext
+		o.Insecure = grpcInsecure
+		o.CaCert = grpcCacert
+		o.ClientCert = grpcClientcert
+		o.ClientKey = grpcClientkey
+		o.TlsServerName = grpcTlsServerName
+		o.Unix = grpcUnix
+		o.Deadline = grpcDeadline
+		o.MaxConcurrentStreams = grpcMaxConcurrentStreams
+		o.Template = grpcTemplate
+		o.EnableLoadBalancer = grpcEnableLoadBalancer
+
 		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := grpc.NewOptions()
-			if len(args) > 0 {
-				o.Target = args[0]
-			}
-			o.Method = grpcMethod
-			o.Headers = grpcHeaders
-			o.Authority = grpcAuthority
-			o.Data = grpcData
-			o.Proto = grpcProtoFiles
-			o.ImportPath = grpcProtoImportPaths
-			o.Plaintext = grpcPlaintext
-			o.Insecure = grpcInsecure
-			o.CaCert = grpcCacert
-			o.ClientCert = grpcClientcert
-			o.ClientKey = grpcClientkey
-			o.TlsServerName = grpcTlsServerName
-			o.Unix = grpcUnix
-			o.Deadline = grpcDeadline
-			o.MaxConcurrentStreams = grpcMaxConcurrentStreams
-			o.Template = grpcTemplate
-			o.EnableLoadBalancer = grpcEnableLoadBalancer
-
-			return grpc.NewGenerator(id, *o, cmd.Context(), s, requestrate)
+			return grpc.NewGenerator(id, *o, ctx, s, requestrate)
 		}
 
 		if grpcTemplate {
@@ -94,10 +93,7 @@ Make the gRPC call but use custom DNS resolver
 			return fmt.Errorf(`mandatory "data" argument was not given`)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
@@ -9,7 +9,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/http"
 	"github.com/freshworks/load-generator/internal/loadgen"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/spf13/cobra"
 )
@@ -86,28 +85,25 @@ lg http --requestrate 10 http://example.com/some/path
 			}
 		}
 
+		o := http.NewOptions()
+		o.DiscardResponse = true
+		o.Method = httpMethod
+		o.Data = httpData
+		o.KeepAlive = !httpNoKeepalive
+		o.Insecure = httpInsecure
+		o.AggregateMethodPath = amp
+		o.Headers = hdr
+		o.ProxyHeaders = proxyHdr
+		o.TlsServerName = tlsServerName
+		o.RootCAs = rootCAs
+
+		o.Url = *u
+
 		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := http.NewOptions()
-			o.DiscardResponse = true
-			o.Method = httpMethod
-			o.Data = httpData
-			o.KeepAlive = !httpNoKeepalive
-			o.Insecure = httpInsecure
-			o.AggregateMethodPath = amp
-			o.Headers = hdr
-			o.ProxyHeaders = proxyHdr
-			o.TlsServerName = tlsServerName
-			o.RootCAs = rootCAs
-
-			o.Url = *u
-
-			return http.NewGenerator(id, *o, cmd.Context(), requestrate, s)
+			return http.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
@@ -9,7 +9,6 @@ import (
 
 	kafkainternal "github.com/freshworks/load-generator/internal/kafka"
 	"github.com/freshworks/load-generator/internal/loadgen"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	kafka "github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl"
@@ -46,30 +45,27 @@ lg kafka --brokers "localhost:9093" --topic "scram-topic" --message "Hello SCRAM
 			}
 		}
 
-		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := kafkainternal.NewOptions()
-			o.Brokers = kafkaBrokers
-			o.Topic = kafkaTopic
-			o.MessageValue = kafkaMessage
-			o.MessageKey = kafkaKey
-			o.GroupID = kafkaGroup
-			o.ReadMessages = kafkaRead
-			
-			// Set SCRAM authentication options if username is provided
-			if kafkaUsername != "" {
-				o.Username = kafkaUsername
-				o.Password = kafkaPassword
-				o.SASLMechanism = kafkaSASLMechanism
-				o.UseTLS = kafkaUseTLS
-			}
+		o := kafkainternal.NewOptions()
+		o.Brokers = kafkaBrokers
+		o.Topic = kafkaTopic
+		o.MessageValue = kafkaMessage
+		o.MessageKey = kafkaKey
+		o.GroupID = kafkaGroup
+		o.ReadMessages = kafkaRead
+		
+		// Set SCRAM authentication options if username is provided
+		if kafkaUsername != "" {
+			o.Username = kafkaUsername
+			o.Password = kafkaPassword
+			o.SASLMechanism = kafkaSASLMechanism
+			o.UseTLS = kafkaUseTLS
+		}
 
+		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
 			return kafkainternal.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
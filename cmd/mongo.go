@@ -5,7 +5,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/loadgen"
 	"github.com/freshworks/load-generator/internal/mongo"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/spf13/cobra"
 )
@@ -54,27 +53,24 @@ lg mongo --database mydb --collection users --operation find --tls mongodb://loc
 			connectionString = args[0]
 		}
 
-		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := mongo.NewOptions()
-			o.ConnectionString = connectionString
-			o.Database = mongoDatabase
-			o.Collection = mongoCollection
-			o.Operation = mongoOperation
-			o.Document = mongoDocument
-			o.Filter = mongoFilter
-			o.Update = mongoUpdate
-			o.Username = mongoUsername
-			o.Password = mongoPassword
-			o.AuthDB = mongoAuthDB
-			o.TLS = mongoTLS
+		o := mongo.NewOptions()
+		o.ConnectionString = connectionString
+		o.Database = mongoDatabase
+		o.Collection = mongoCollection
+		o.Operation = mongoOperation
+		o.Document = mongoDocument
+		o.Filter = mongoFilter
+		o.Update = mongoUpdate
+		o.Username = mongoUsername
+		o.Password = mongoPassword
+		o.AuthDB = mongoAuthDB
+		o.TLS = mongoTLS
 
+		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
 			return mongo.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
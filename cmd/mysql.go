@@ -5,7 +5,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/loadgen"
 	"github.com/freshworks/load-generator/internal/mysql"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -30,17 +29,15 @@ lg mysql --requestrate 10 --duration 10s --query 'SHOW DATABASES' 'myuser:mypass
 			args = []string{o.Target}
 		}
 
+		o := mysql.NewOptions()
+		o.Target = args[0]
+		o.Query = mysqlQuery
+
 		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := mysql.NewOptions()
-			o.Target = args[0]
-			o.Query = mysqlQuery
-			return mysql.NewGenerator(id, *o, cmd.Context(), requestrate, s)
+			return mysql.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
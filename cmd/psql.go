@@ -5,7 +5,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/loadgen"
 	"github.com/freshworks/load-generator/internal/psql"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -27,21 +26,19 @@ Generates psql load using given query. It reports metrics by fingerprinting SQL
 	`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		o := psql.NewOptions()
+		if len(args) == 0 {
+			logrus.Warnf("connection string not specified, using default settings: %v", o.ConnectionString)
+		} else if len(args) == 1 {
+			o.ConnectionString = args[0]
+		}
+		o.Query = psqlQuery
+
 		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := psql.NewOptions()
-			if len(args) == 0 {
-				logrus.Warnf("connection string not specified, using default settings: %v", o.ConnectionString)
-			} else if len(args) == 1 {
-				o.ConnectionString = args[0]
-			}
-			o.Query = psqlQuery
 			return psql.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
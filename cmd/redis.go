@@ -5,7 +5,6 @@ import (
 
 	"github.com/freshworks/load-generator/internal/loadgen"
 	"github.com/freshworks/load-generator/internal/redis"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/spf13/cobra"
 )
@@ -22,22 +21,19 @@ lg redis --requestrate 10 --cmd "GET" --arg "foo" 127.0.0.1:6379
 `,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		o := redis.NewOptions()
+		o.Target = args[0]
+		o.Cmd = redisCommand
+		o.Args = redisArgs
+		o.Password = redisPassword
+		o.Username = redisUsername
+		o.Database = redisDatabase
+
 		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := redis.NewOptions()
-			o.Target = args[0]
-			o.Cmd = redisCommand
-			o.Args = redisArgs
-			o.Password = redisPassword
-			o.Username = redisUsername
-			o.Database = redisDatabase
-
-			return redis.NewGenerator(id, *o, cmd.Context(), requestrate, s)
+			return redis.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
@@ -2,15 +2,19 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"net/rpc"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"sync"
 	"time"
 
+	"github.com/freshworks/load-generator/internal/htmlreport"
+	"github.com/freshworks/load-generator/internal/loadgen"
+	"github.com/freshworks/load-generator/internal/runner"
+	"github.com/freshworks/load-generator/internal/server"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -25,9 +29,52 @@ var debug bool
 var verbose bool
 var profile string
 var exportReport string
+var exportFormat string
+var htmlReport string
+var percentilesFlag string
+var histogramMax time.Duration
+var histogramPrecision int
+var histogramUnit time.Duration
+var thresholdsFlag string
+var thresholds []stats.Threshold
 var serverAddr string
 var stat *stats.Stats
 var id string
+var stagesFlag string
+var stages []runner.Stage
+var arrivalFlag string
+var arrival runner.Distribution
+var users int
+var thinkTime time.Duration
+var thinkDistFlag string
+var thinkDist runner.Distribution
+var iterations int
+var iterationsPerWorker int
+var controlAddr string
+var stopTimeout time.Duration
+var maxInitFailures float64
+var restartWorkers bool
+var restartBackoff time.Duration
+var minWorkers int
+var maxWorkers int
+var startAtFlag string
+var startAt time.Time
+var startBarrierFlag bool
+var startBarrier func(ctx context.Context) (time.Time, error)
+var snapshotInterval time.Duration
+var reportInterval time.Duration
+var reportIntervalFormat string
+var metricsAddr string
+var stopMetrics func()
+var otlpOptions = stats.NewOTLPOptions()
+var sinkURLs []string
+var sinkInterval time.Duration
+var sinkName string
+var histogramLog string
+var histogramLogInterval time.Duration
+var histogramLogFile *os.File
+var findMax string
+var searchOptions = runner.NewSearchOptions()
 
 var rootCmd = &cobra.Command{
 	Use:          "lg",
@@ -46,6 +93,103 @@ var rootCmd = &cobra.Command{
 			logrus.SetLevel(logrus.DebugLevel)
 		}
 
+		var err error
+		if stagesFlag != "" {
+			stages, err = runner.ParseStages(stagesFlag)
+			if err != nil {
+				return err
+			}
+
+			// Size everything for the peak rate
+			for _, s := range stages {
+				if s.Target > requestrate {
+					requestrate = s.Target
+				}
+			}
+			duration = runner.StagesDuration(stages)
+		}
+
+		arrival, err = runner.ParseDistribution(arrivalFlag)
+		if err != nil {
+			return err
+		}
+
+		thinkDist, err = runner.ParseDistribution(thinkDistFlag)
+		if err != nil {
+			return err
+		}
+
+		if users > 0 {
+			if stagesFlag != "" {
+				return fmt.Errorf("--users and --stages can't be used together")
+			}
+
+			// Virtual users run back to back, the rate is decided by them
+			requestrate = 0
+			concurrency = users
+		}
+
+		if err := stats.ValidFormat(exportFormat); err != nil {
+			return err
+		}
+
+		if thresholdsFlag != "" {
+			thresholds, err = stats.ParseThresholds(thresholdsFlag)
+			if err != nil {
+				return err
+			}
+		}
+
+		if findMax != "" {
+			searchOptions.SLO, err = stats.ParseThresholds(findMax)
+			if err != nil {
+				return err
+			}
+
+			if duration == 0 {
+				return fmt.Errorf("--find-max needs a --duration for each step")
+			}
+
+			if users > 0 || stagesFlag != "" {
+				return fmt.Errorf("--find-max can't be used with --users or --stages")
+			}
+
+			// Otherwise concurrency follows the rate of each step
+			if cmd.Flags().Changed("concurrency") {
+				searchOptions.Concurrency = concurrency
+			}
+		}
+
+		if startAtFlag != "" {
+			startAt, err = time.Parse(time.RFC3339Nano, startAtFlag)
+			if err != nil {
+				return fmt.Errorf("invalid --start-at, expected an RFC3339 time (ex: 2024-05-01T10:00:00Z): %v", err)
+			}
+		}
+
+		if startBarrierFlag {
+			if serverAddr == "" {
+				return fmt.Errorf("--start-barrier needs the lg --server to wait at")
+			}
+			if startAtFlag != "" {
+				return fmt.Errorf("--start-at and --start-barrier can't be used together")
+			}
+			startBarrier = newStartBarrier()
+		}
+
+		if maxWorkers > 0 {
+			if requestrate == 0 || users > 0 || stagesFlag != "" || findMax != "" {
+				return fmt.Errorf("--max-workers needs a --requestrate and can't be used with --users, --stages or --find-max")
+			}
+
+			if minWorkers > maxWorkers {
+				return fmt.Errorf("--min-workers (%d) is more than --max-workers (%d)", minWorkers, maxWorkers)
+			}
+
+			// Workers are sized by the pool
+			concurrency = maxWorkers
+		}
+
 		if concurrency == 0 {
 			concurrency = requestrate
 		}
@@ -54,13 +198,71 @@ var rootCmd = &cobra.Command{
 			concurrency = 1
 		}
 
+		percentiles, err := stats.ParsePercentiles(percentilesFlag)
+		if err != nil {
+			return err
+		}
+		stats.SetPercentiles(percentiles)
+		if err := stats.SetHistogram(histogramMax, histogramPrecision, histogramUnit); err != nil {
+			return err
+		}
+
 		stat = stats.New(id, requestrate, concurrency, duration, cmd.Name() == "server")
+		stat.SetInterval(snapshotInterval)
+		if err := stat.SetLiveReport(reportInterval, reportIntervalFormat, os.Stdout); err != nil {
+			return err
+		}
+		if otlpOptions.Endpoint != "" {
+			if cmd.Name() == "server" {
+				return fmt.Errorf("--otlp-endpoint is not supported in server mode, use it on the clients")
+			}
+			otlpOptions.Command = cmd.Name()
+			if err := stat.SetOTLP(*otlpOptions); err != nil {
+				return err
+			}
+		}
+		if len(sinkURLs) > 0 {
+			if cmd.Name() == "server" {
+				return fmt.Errorf("--sink is not supported in server mode, use it on the clients")
+			}
+			sinks := make([]stats.Sink, 0, len(sinkURLs))
+			for _, u := range sinkURLs {
+				sink, err := stats.NewSink(u, sinkName)
+				if err != nil {
+					return err
+				}
+				sinks = append(sinks, sink)
+			}
+			stat.SetSinks(sinkInterval, sinks...)
+		}
+		if histogramLog != "" {
+			if cmd.Name() == "server" {
+				return fmt.Errorf("--hlog is not supported in server mode, use it on the clients")
+			}
+			f, err := os.Create(histogramLog)
+			if err != nil {
+				return fmt.Errorf("histogram log: %v", err)
+			}
+			histogramLogFile = f
+			stat.SetHistogramLog(f, histogramLogInterval)
+		}
 		stat.Start()
 
+		if metricsAddr != "" {
+			stopMetrics = serveMetrics(metricsAddr)
+		}
+
 		return nil
 	},
 	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		// Closed once the stats wrote the last entries
+		if histogramLogFile != nil {
+			defer histogramLogFile.Close()
+		}
 		defer stat.Stop()
+		if stopMetrics != nil {
+			defer stopMetrics()
+		}
 
 		if profile != "" {
 			finishProfile()
@@ -73,6 +275,13 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
+		if htmlReport != "" {
+			err := writeHTMLReport()
+			if err != nil {
+				return err
+			}
+		}
+
 		if serverAddr != "" {
 			logrus.Infof("Publishing stats to %v\n", serverAddr)
 
@@ -89,6 +298,16 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
+		if len(thresholds) > 0 {
+			breaches := stat.Export().Breaches(thresholds)
+			for _, b := range breaches {
+				logrus.Errorf("Threshold breached: %s", b)
+			}
+			if len(breaches) > 0 {
+				return fmt.Errorf("%d thresholds breached", len(breaches))
+			}
+		}
+
 		return nil
 	},
 }
@@ -110,8 +329,146 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Debug mode, useful to debug hung Lua scripts")
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Set this to enable verbose logging")
 	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Generate cpu/memory profile file")
-	rootCmd.PersistentFlags().StringVar(&exportReport, "export", "", "Export results in json format")
+	rootCmd.PersistentFlags().StringVar(&exportReport, "export", "", "Export results to this file, in the --export-format")
+	rootCmd.PersistentFlags().StringVar(&exportFormat, "export-format", stats.FormatJSON, "Format of the --export file: json (the whole report), csv (a row per result with percentiles, rate, errors and status classes) or junit (a testcase per result, failed if it breaches --thresholds)")
+	rootCmd.PersistentFlags().StringVar(&percentilesFlag, "percentiles", "50,75,90,95,99,99.99", "Comma separated latency percentiles shown in the tables and exported in the reports")
+	rootCmd.PersistentFlags().DurationVar(&histogramMax, "histogram-max", 5*time.Minute, "Highest latency the histograms can track, higher ones are dropped (\"Failed to add value to histogram\")")
+	rootCmd.PersistentFlags().IntVar(&histogramPrecision, "histogram-precision", 3, "Precision of the latency histograms in significant digits (1 to 5), more takes more memory")
+	rootCmd.PersistentFlags().DurationVar(&histogramUnit, "histogram-unit", time.Microsecond, "Unit the latencies are tracked in, shorter ones are recorded as 0. 1ns for sub-microsecond requests (ex: Redis on localhost), at the cost of a little more memory")
+	rootCmd.PersistentFlags().StringVar(&htmlReport, "html-report", "", "Write the results to this file as a self-contained HTML report (summary, latency percentiles and histograms, metrics over time, queries and run details), viewable offline")
+	rootCmd.PersistentFlags().StringVar(&thresholdsFlag, "thresholds", "", `Thresholds every result has to meet (comma separated, on p<percentile>, avg, min, max, errors or rps, ex: "p99<200ms,errors<0.1%"), the run fails if any is breached`)
 	rootCmd.PersistentFlags().StringVar(&serverAddr, "server", "", "Publish reports to remote lg server")
+	rootCmd.PersistentFlags().DurationVar(&reportInterval, "report-interval", 0, "Print a line for every result at this interval while the run is going: rate, p50, p99 and errors of the interval, along with the totals so far")
+	rootCmd.PersistentFlags().StringVar(&reportIntervalFormat, "report-interval-format", "text", "Format of the --report-interval lines: text or json (JSON lines)")
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "Serve the metrics collected so far on this address (ex: :9090) for Prometheus to scrape at /metrics while the run is going (lg server also serves them on its own address)")
+	rootCmd.PersistentFlags().StringVar(&otlpOptions.Endpoint, "otlp-endpoint", "", "Push the metrics to this OpenTelemetry collector over OTLP while the run is going (ex: http://localhost:4317, https for TLS). Latencies are sent as exponential histograms, the run id, command and host as resource attributes. The OTEL_EXPORTER_OTLP_* environment variables (ex: headers) are honored")
+	rootCmd.PersistentFlags().StringVar(&otlpOptions.Protocol, "otlp-protocol", otlpOptions.Protocol, "OTLP protocol: grpc or http (protobuf)")
+	rootCmd.PersistentFlags().DurationVar(&otlpOptions.Interval, "otlp-interval", otlpOptions.Interval, "How often the metrics are pushed with --otlp-endpoint")
+	rootCmd.PersistentFlags().StringArrayVar(&sinkURLs, "sink", nil, "Push the count, errors, rate and latencies (ms) of every result over each --sink-interval to: statsd://host:port (UDP), graphite://host:port (plaintext) or influx://host:port/<write path> (InfluxDB line protocol over HTTP, influxs for HTTPS, ex: influx://localhost:8086/write?db=lg, INFLUX_TOKEN is sent as the API token). Can be repeated")
+	rootCmd.PersistentFlags().DurationVar(&sinkInterval, "sink-interval", 10*time.Second, "How often the --sink metrics are pushed")
+	rootCmd.PersistentFlags().StringVar(&sinkName, "sink-name", "", `Template of the --sink metric names (InfluxDB measurement) from .Type, .Target and .SubTarget, ex: "loadtest.{{.Target}}.{{.SubTarget}}". Default is "lg.{{.Type}}.{{.Target}}.{{.SubTarget}}" ("lg" for InfluxDB, which gets them as tags)`)
+	rootCmd.PersistentFlags().StringVar(&histogramLog, "hlog", "", "Write the latency histograms of every result for each --hlog-interval to this file in the HdrHistogram interval log format (.hlog), tagged <type>/<target>/<subtarget>, for HdrHistogram tools such as HistogramLogAnalyzer or hdr-plot. Latencies are in nanoseconds")
+	rootCmd.PersistentFlags().DurationVar(&histogramLogInterval, "hlog-interval", time.Second, "Length of the --hlog intervals")
+	rootCmd.PersistentFlags().DurationVar(&snapshotInterval, "snapshot-interval", 10*time.Second, "Keep a snapshot (count, errors, rate and latency percentiles) of every result for each interval of this length, exported in the report (Intervals) and shown in the server's graphs. 0 disables them")
+	rootCmd.PersistentFlags().StringVar(&stagesFlag, "stages", "", `Staged load profile, comma separated <duration>:<rate> stages, rate is ramped linearly from the previous stage's rate (0 for the first one). Overrides --requestrate and --duration, --warmup is counted from the start of the first stage. Use @file to read stages from a file. Ex: --stages "2m:500,10m:500,30s:2000,1m:0"`)
+	rootCmd.PersistentFlags().StringVar(&arrivalFlag, "arrival", "constant", `Distribution of the gaps between requests when the request rate is controlled: constant (evenly spaced), poisson (exponential gaps), uniform[:<jitter>] (within +/- jitter of the mean gap, 0-1, default 1) or empirical:<file> (gaps sampled from the file, one per line as a duration or milliseconds). The average rate is still decided by --requestrate/--stages`)
+	rootCmd.PersistentFlags().IntVar(&users, "users", 0, "Closed loop mode: number of virtual users, each running one request (or script tick) after the other with --think-time in between. Overrides --requestrate and --concurrency, iteration rate of each user is reported")
+	rootCmd.PersistentFlags().DurationVar(&thinkTime, "think-time", 0, "Time each virtual user waits between iterations (with --users)")
+	rootCmd.PersistentFlags().StringVar(&thinkDistFlag, "think-time-dist", "constant", "Distribution of the think time around --think-time: constant, poisson, uniform[:<jitter>] or empirical:<file> (see --arrival)")
+	rootCmd.PersistentFlags().IntVar(&iterations, "iterations", 0, "Stop after this many requests (or script ticks) in total, once in-flight ones are done. The report says whether the budget was met")
+	rootCmd.PersistentFlags().IntVar(&iterationsPerWorker, "iterations-per-worker", 0, "Stop each worker after this many requests (or script ticks)")
+	rootCmd.PersistentFlags().DurationVar(&stopTimeout, "stop-timeout", 10*time.Second, "Once the run is done (or interrupted), how long in-flight requests are given to finish before they are cancelled (and reported as abandoned)")
+	rootCmd.PersistentFlags().Float64Var(&maxInitFailures, "max-init-failures", 100, "Abort the run if more than this percentage of the workers fail to initialize (ex: connection errors), by default the run goes on with whichever workers are left")
+	rootCmd.PersistentFlags().BoolVar(&restartWorkers, "restart-workers", false, "Restart workers whose request (or script tick) failed instead of retiring them: the worker is finished and initialized again after --restart-backoff")
+	rootCmd.PersistentFlags().DurationVar(&restartBackoff, "restart-backoff", time.Second, "Wait before restarting a failed worker, doubled on each failed attempt (up to a minute)")
+	rootCmd.PersistentFlags().IntVar(&minWorkers, "min-workers", 1, "Number of workers the elastic worker pool starts with and doesn't go below (with --max-workers)")
+	rootCmd.PersistentFlags().IntVar(&maxWorkers, "max-workers", 0, "Elastic worker pool: instead of a fixed --concurrency, add workers up to this many while the request rate is missed and retire idle ones. Changes are shown in the report")
+	rootCmd.PersistentFlags().StringVar(&startAtFlag, "start-at", "", "Initialize the workers and wait until this time (RFC3339, ex: 2024-05-01T10:00:00Z) to start, to start runs on several hosts together")
+	rootCmd.PersistentFlags().BoolVar(&startBarrierFlag, "start-barrier", false, "Initialize the workers and wait at the start barrier of the lg --server (see lg server --barrier), to start together with the other clients")
+	rootCmd.PersistentFlags().StringVar(&controlAddr, "control-addr", "", "Serve the control API on this address (ex: localhost:8090) to change the run while it is going: GET /status, POST /rate?value=<rps>, POST /workers?value=<n>, POST /pause, POST /resume and POST /reset (metrics). SIGUSR1 also pauses/resumes and SIGUSR2 resets metrics")
+	rootCmd.PersistentFlags().StringVar(&findMax, "find-max", "", `Search for the highest request rate meeting the given SLO (comma separated thresholds on p<percentile>, avg, min, max, errors or rps, ex: "p99<200ms,errors<0.1%"). Each step runs for --warmup + --duration, the rate is doubled from --find-max-start until the SLO is breached and then binary searched`)
+	rootCmd.PersistentFlags().IntVar(&searchOptions.StartRate, "find-max-start", searchOptions.StartRate, "Request rate of the first --find-max step")
+	rootCmd.PersistentFlags().IntVar(&searchOptions.MaxRate, "find-max-limit", 0, "Highest request rate to try with --find-max (0 for no limit)")
+	rootCmd.PersistentFlags().Float64Var(&searchOptions.Precision, "find-max-precision", searchOptions.Precision, "Stop --find-max once the highest passing and the lowest failing rates are within this fraction of each other")
+}
+
+// serveMetrics serves the Prometheus metrics on addr, until the returned
+// function is called
+func serveMetrics(addr string) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", stat.PrometheusHandler())
+
+	h := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		logrus.Infof("Prometheus metrics on http://%s/metrics", addr)
+		if err := h.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Warnf("Prometheus metrics: %v", err)
+		}
+	}()
+
+	return func() {
+		h.Shutdown(context.Background())
+	}
+}
+
+// runLoad runs the load (or the max throughput search) with the generators
+// returned by newGenerator
+func runLoad(ctx context.Context, newGenerator loadgen.NewGenerator) error {
+	if generatorCollector != nil {
+		generatorCollector(newGenerator)
+		return nil
+	}
+
+	if findMax != "" {
+		_, err := runner.Search(runnerOptions(), *searchOptions, ctx, stat, newGenerator)
+		return err
+	}
+
+	runr := runner.New(runnerOptions(), ctx, stat, newGenerator)
+	return runr.Run()
+}
+
+func runnerOptions() runner.Options {
+	o := runner.NewOptions()
+	o.RequestRate = requestrate
+	o.Concurrency = concurrency
+	o.Warmup = warmup
+	o.Duration = duration
+	o.Stages = stages
+	o.Arrival = arrival
+	o.Users = users
+	o.ThinkTime = thinkTime
+	o.ThinkDist = thinkDist
+	o.Iterations = iterations
+	o.IterationsPerWorker = iterationsPerWorker
+	o.ControlAddr = controlAddr
+	o.StopTimeout = stopTimeout
+	o.MaxInitFailures = maxInitFailures
+	o.RestartWorkers = restartWorkers
+	o.RestartBackoff = restartBackoff
+	o.MinWorkers = minWorkers
+	o.MaxWorkers = maxWorkers
+	o.StartAt = startAt
+	o.StartBarrier = startBarrier
+
+	return *o
+}
+
+// newStartBarrier returns the start barrier of the runs, clients wait at the
+// barrier of the lg server once (for all the runs of the process)
+func newStartBarrier() func(ctx context.Context) (time.Time, error) {
+	var once sync.Once
+	var at time.Time
+	var err error
+
+	return func(ctx context.Context) (time.Time, error) {
+		once.Do(func() {
+			at, err = waitStartBarrier(ctx)
+		})
+		return at, err
+	}
+}
+
+func waitStartBarrier(ctx context.Context) (time.Time, error) {
+	client, err := rpc.DialHTTP("tcp", serverAddr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error connecting to server: %v", err)
+	}
+	defer client.Close()
+
+	host, _ := os.Hostname()
+	var reply server.BarrierReply
+	call := client.Go("LG.Barrier", &server.BarrierArgs{ID: id, Host: host}, &reply, nil)
+
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return time.Time{}, call.Error
+		}
+		return time.Now().Add(reply.Delay), nil
+	case <-ctx.Done():
+		return time.Time{}, ctx.Err()
+	}
 }
 
 func initConfig() {
@@ -146,16 +503,29 @@ func finishProfile() {
 }
 
 func writeReport() error {
-	res := stat.Export()
-	j, err := json.MarshalIndent(res, "", " ")
+	f, err := os.OpenFile(exportReport, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(exportReport, j, os.ModePerm)
+	if err := stat.Export().Write(f, exportFormat, thresholds); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeHTMLReport() error {
+	f, err := os.Create(htmlReport)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := htmlreport.Write(f, stat.Export()); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
 }
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/freshworks/load-generator/internal/loadgen"
+	"github.com/freshworks/load-generator/internal/runner"
+	"github.com/freshworks/load-generator/internal/stats"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var scenarioCmd = &cobra.Command{
+	Use:   "scenario <scenario file>",
+	Short: "Run several weighted load generators together",
+	Long: `Run several weighted load generators together
+
+The scenario file lists the load generators to run in a single process, all
+of them are reported together, with the targets prefixed by the scenario name
+(ex: home/https://example.com). Each scenario is an lg command line (without
+the global flags) with a weight, --requestrate and --concurrency are split
+between the scenarios by weight unless the scenario sets its own, and so are
+--iterations and --max-workers (--min-workers is per scenario). Scenarios
+with a weight of 0 are disabled:
+
+{
+  "scenarios": [
+    {"name": "home", "weight": 3, "command": ["http", "https://example.com/"]},
+    {"name": "search", "weight": 1, "command": ["http", "--method", "POST", "--data", "{}", "https://example.com/search"]},
+    {"name": "cache", "requestrate": 50, "concurrency": 5, "command": ["redis", "--cmd", "GET", "--arg", "foo", "127.0.0.1:6379"]}
+  ]
+}
+`,
+	Example: `
+lg scenario --requestrate 100 --duration 1m ./scenarios.json
+`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if stagesFlag != "" || users > 0 || findMax != "" {
+			return fmt.Errorf("--stages, --users and --find-max can't be used with scenarios")
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scenarios, err := loadScenarios(args[0])
+		if err != nil {
+			return err
+		}
+
+		runners := []*runner.Runner{}
+		for _, sc := range scenarios {
+			newGenerator, err := scenarioGenerator(cmd.Context(), sc)
+			if err != nil {
+				return fmt.Errorf("scenario %s: %v", sc.Name, err)
+			}
+
+			o := runnerOptions()
+			o.RequestRate, o.Concurrency = sc.rates(scenarios)
+			o.Iterations = sc.share(iterations, scenarios)
+			o.MaxWorkers = sc.share(maxWorkers, scenarios)
+			if controlAddr != "" {
+				// Each scenario would need its own
+				logrus.Warnf("Control API isn't available with scenarios")
+				o.ControlAddr = ""
+			}
+
+			// Results of the scenarios hitting the same targets apart
+			scoped := stat.Scoped(sc.Name)
+			newScopedGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, _ *stats.Stats) loadgen.Generator {
+				return newGenerator(id, requestrate, concurrency, ctx, scoped)
+			}
+
+			logrus.Infof("Scenario %s: %d rps, %d workers: %s", sc.Name, o.RequestRate, o.Concurrency, strings.Join(sc.Command, " "))
+			runners = append(runners, runner.New(o, cmd.Context(), stat, newScopedGenerator))
+		}
+
+		return runner.RunAll(runners, stat)
+	},
+}
+
+type scenarioFile struct {
+	Scenarios []*scenario `json:"scenarios"`
+}
+
+type scenario struct {
+	Name string `json:"name"`
+	// Share of --requestrate and --concurrency, 1 if not set and disabled
+	// if 0
+	Weight *float64 `json:"weight"`
+	// Overrides the weighted share
+	RequestRate *int `json:"requestrate"`
+	Concurrency *int `json:"concurrency"`
+	// lg command line, ex: ["http", "--method", "POST", "https://example.com"]
+	Command []string `json:"command"`
+}
+
+func loadScenarios(file string) ([]*scenario, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sf scenarioFile
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&sf); err != nil {
+		return nil, fmt.Errorf("error reading scenarios (%s): %v", file, err)
+	}
+
+	if len(sf.Scenarios) == 0 {
+		return nil, fmt.Errorf("no scenarios in %s", file)
+	}
+
+	var scenarios []*scenario
+	for i, sc := range sf.Scenarios {
+		if sc.Name == "" {
+			sc.Name = fmt.Sprint(i + 1)
+		}
+
+		if sc.Weight == nil {
+			w := 1.0
+			sc.Weight = &w
+		}
+
+		if *sc.Weight < 0 {
+			return nil, fmt.Errorf("scenario %s: negative weight", sc.Name)
+		}
+
+		if len(sc.Command) == 0 {
+			return nil, fmt.Errorf("scenario %s: no command", sc.Name)
+		}
+
+		if *sc.Weight == 0 {
+			logrus.Infof("Scenario %s: disabled (weight 0)", sc.Name)
+			continue
+		}
+
+		scenarios = append(scenarios, sc)
+	}
+
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("all the scenarios in %s are disabled", file)
+	}
+
+	return scenarios, nil
+}
+
+// rates gives the request rate and concurrency of the scenario, its own or
+// its weighted share of the global ones
+func (sc *scenario) rates(scenarios []*scenario) (int, int) {
+	total := 0.0
+	for _, s := range scenarios {
+		total += *s.Weight
+	}
+	share := *sc.Weight / total
+
+	r := int(math.Round(float64(requestrate) * share))
+	if sc.RequestRate != nil {
+		r = *sc.RequestRate
+	} else if requestrate > 0 && r == 0 {
+		r = 1
+	}
+
+	c := int(math.Ceil(float64(concurrency) * share))
+	if sc.Concurrency != nil {
+		c = *sc.Concurrency
+	} else if sc.RequestRate != nil && *sc.RequestRate > 0 {
+		// Same default as the commands: as many workers as the rate
+		c = *sc.RequestRate
+	}
+	if c < 1 {
+		c = 1
+	}
+
+	return r, c
+}
+
+// share gives the weighted share of the scenario of a global total (ex:
+// --iterations). The shares add up to the total, rounded so that none is 0
+// (which would be no limit) if the total isn't.
+func (sc *scenario) share(n int, scenarios []*scenario) int {
+	if n <= 0 {
+		return n
+	}
+
+	total, before := 0.0, 0.0
+	for _, s := range scenarios {
+		if s == sc {
+			before = total
+		}
+		total += *s.Weight
+	}
+
+	from := int(math.Round(float64(n) * before / total))
+	to := int(math.Round(float64(n) * (before + *sc.Weight) / total))
+	return max(to-from, 1)
+}
+
+// generatorCollector, when set, gets the generator of the command instead of
+// running it
+var generatorCollector func(newGenerator loadgen.NewGenerator)
+
+// scenarioGenerator parses the scenario's command line with its lg command
+// and returns the generator the command would run
+func scenarioGenerator(ctx context.Context, sc *scenario) (loadgen.NewGenerator, error) {
+	c, args, err := rootCmd.Find(sc.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	if c == rootCmd || c.RunE == nil || c.Name() == "scenario" || c.Name() == "server" {
+		return nil, fmt.Errorf("%q isn't a load generator command", sc.Command[0])
+	}
+
+	// Flags keep the values from the previous scenario using the command
+	c.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			sv.Replace([]string{})
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+
+	// Global flags are shared with this invocation, so look for changed
+	// values rather than changed flags
+	inherited := map[string]string{}
+	c.InheritedFlags().VisitAll(func(f *pflag.Flag) {
+		inherited[f.Name] = f.Value.String()
+	})
+
+	if err := c.ParseFlags(args); err != nil {
+		return nil, err
+	}
+
+	var global []string
+	c.InheritedFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Value.String() != inherited[f.Name] {
+			global = append(global, "--"+f.Name)
+		}
+	})
+	if len(global) > 0 {
+		return nil, fmt.Errorf("global flags (%s) can't be set per scenario", strings.Join(global, ", "))
+	}
+
+	args = c.Flags().Args()
+	if err := c.ValidateArgs(args); err != nil {
+		return nil, err
+	}
+
+	if err := c.ValidateRequiredFlags(); err != nil {
+		return nil, err
+	}
+
+	c.SetContext(ctx)
+	if c.PreRunE != nil {
+		if err := c.PreRunE(c, args); err != nil {
+			return nil, err
+		}
+	}
+
+	var newGenerator loadgen.NewGenerator
+	generatorCollector = func(g loadgen.NewGenerator) {
+		newGenerator = g
+	}
+	defer func() {
+		generatorCollector = nil
+	}()
+
+	if err := c.RunE(c, args); err != nil {
+		return nil, err
+	}
+
+	if newGenerator == nil {
+		return nil, fmt.Errorf("%q didn't generate any load", strings.Join(sc.Command, " "))
+	}
+
+	return newGenerator, nil
+}
+
+func init() {
+	rootCmd.AddCommand(scenarioCmd)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenarios(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "scenarios.json")
+	err := os.WriteFile(file, []byte(`{
+  "scenarios": [
+    {"name": "post", "weight": 3, "command": ["http", "--method", "POST", "--header", "a: b", "http://127.0.0.1/post"]},
+    {"name": "get", "command": ["http", "http://127.0.0.1/get"]},
+    {"name": "cache", "requestrate": 50, "command": ["redis", "--cmd", "GET", "--arg", "foo", "127.0.0.1:6379"]},
+    {"name": "disabled", "weight": 0, "command": ["http", "http://127.0.0.1/disabled"]}
+  ]
+}`), 0644)
+	require.NoError(t, err)
+
+	scenarios, err := loadScenarios(file)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(scenarios))
+	assert.Equal(t, 1.0, *scenarios[1].Weight)
+	assert.Equal(t, "cache", scenarios[2].Name)
+
+	requestrate, concurrency = 100, 10
+	defer func() {
+		requestrate, concurrency = 0, 0
+	}()
+
+	r, c := scenarios[0].rates(scenarios)
+	assert.Equal(t, 60, r)
+	assert.Equal(t, 6, c)
+	r, c = scenarios[1].rates(scenarios)
+	assert.Equal(t, 20, r)
+	assert.Equal(t, 2, c)
+	r, c = scenarios[2].rates(scenarios)
+	assert.Equal(t, 50, r)
+	assert.Equal(t, 50, c)
+
+	// Shares of the global totals add up, none is left without
+	var shares []int
+	for _, sc := range scenarios {
+		shares = append(shares, sc.share(10, scenarios))
+	}
+	assert.Equal(t, []int{6, 2, 2}, shares)
+	assert.Equal(t, 1, scenarios[2].share(2, scenarios))
+	assert.Equal(t, 0, scenarios[0].share(0, scenarios))
+
+	ctx := context.Background()
+	for _, sc := range scenarios {
+		g, err := scenarioGenerator(ctx, sc)
+		require.NoError(t, err)
+		assert.NotNil(t, g)
+	}
+
+	err = os.WriteFile(file, []byte(`{"scenarios": [{"weight": 0, "command": ["http", "http://127.0.0.1/"]}]}`), 0644)
+	require.NoError(t, err)
+	_, err = loadScenarios(file)
+	assert.Error(t, err)
+
+	// Flags of the previous scenario with the same command are not kept
+	assert.Equal(t, "GET", httpMethod)
+	assert.Empty(t, httpHeaders)
+
+	for _, command := range [][]string{
+		{"http", "--requestrate", "5", "http://127.0.0.1/"},
+		{"http", "--foo", "http://127.0.0.1/"},
+		{"http", "ftp://127.0.0.1/"},
+		{"redis", "127.0.0.1:6379"},
+		{"server", "localhost:8080"},
+		{"nosuchcommand"},
+	} {
+		_, err := scenarioGenerator(ctx, &scenario{Name: "bad", Command: command})
+		assert.Errorf(t, err, "%v", command)
+	}
+}
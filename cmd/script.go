@@ -2,10 +2,10 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/freshworks/load-generator/internal/loadgen"
 	"github.com/freshworks/load-generator/internal/lua"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/spf13/cobra"
 )
@@ -20,36 +20,48 @@ Generate load by using Lua script. All other load generating methods supported b
 Payloads can be customized on the fly.
 Load generation can be combined ("make one grpc call, then make another http call, together (and separately) report metrics" etc)
 All the metrics are transparently collected and reported at the end.
+
+Tick data (LG:SetTickDataFile) with timestamps, ex: access logs, can be replayed
+with its original arrival pattern by calling LG:SetTickDataTimestamp(<column>, <layout>)
+in the script: each row is handed to tick() at the time of its timestamp
+(relative to the first row), sped up or slowed down by --replay-speed. The
+replay decides the rate instead of --requestrate, use enough --concurrency for
+the requests in flight at once.
 `,
 	Example: `
 lg script /path/to/my/script.lua
 lg script --requestrate 10 ./scripts/test.lua -- --foo bar
+lg script --concurrency 50 --replay-speed 2 ./scripts/replay.lua
 `,
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := lua.NewOptions()
-			o.Script = args[0]
-			o.Debug = debug
+		if replaySpeed <= 0 {
+			return fmt.Errorf("--replay-speed should be more than 0")
+		}
 
-			n := cmd.ArgsLenAtDash()
-			if n >= 0 {
-				o.Args = args[n:]
-			}
+		o := lua.NewOptions()
+		o.Script = args[0]
+		o.Debug = debug
+		o.ReplaySpeed = replaySpeed
 
-			return lua.NewGenerator(*o, id, requestrate, concurrency, ctx, s)
+		n := cmd.ArgsLenAtDash()
+		if n >= 0 {
+			o.Args = args[n:]
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
+		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+			return lua.NewGenerator(*o, id, requestrate, concurrency, ctx, s)
+		}
 
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
 var scriptDebug bool
+var replaySpeed float64
 
 func init() {
 	rootCmd.AddCommand(scriptCmd)
 	scriptCmd.Flags().BoolVar(&scriptDebug, "debug", false, "Debug Lua script")
+	scriptCmd.Flags().Float64Var(&replaySpeed, "replay-speed", 1, "Speed factor of the tick data replay (LG:SetTickDataTimestamp), ex: 2 for twice as fast, 0.5 for half the speed")
 }
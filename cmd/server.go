@@ -11,21 +11,32 @@ var serverCmd = &cobra.Command{
 	Long: `Runs in server mode.
 In server mode, it just runs without generating any load, receives the metrics from clients, aggregates the metrics and publishes them.
 It also exposes UI for viewing the latency graphs.
+
+With --barrier, clients run with --start-barrier wait until that many of them
+are ready and then all start together, --barrier-delay after the last one
+joined.
 `,
 	Example: `
+lg server --barrier 3 :8080
+lg http --server server-host:8080 --start-barrier --duration 5m https://example.com/
 `,
 	Args: cobra.ExactArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return server.Run(stat, args[0], cmd.Context(), importReport, exportReport)
+		serverOptions.ExportReport = exportReport
+		serverOptions.ExportFormat = exportFormat
+		serverOptions.Thresholds = thresholds
+		return server.Run(stat, args[0], cmd.Context(), *serverOptions)
 	},
 }
 
-var importReport string
+var serverOptions = server.NewOptions()
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
-	serverCmd.Flags().StringVar(&importReport, "import", "", "Report to import")
+	serverCmd.Flags().StringVar(&serverOptions.ImportReport, "import", "", "Report to import")
+	serverCmd.Flags().IntVar(&serverOptions.BarrierClients, "barrier", 0, "Number of clients (run with --start-barrier) to wait for before starting all of them together")
+	serverCmd.Flags().DurationVar(&serverOptions.BarrierDelay, "barrier-delay", serverOptions.BarrierDelay, "How long after the last client joined the barrier the clients start")
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/freshworks/load-generator/internal/loadgen"
-	"github.com/freshworks/load-generator/internal/runner"
 	"github.com/freshworks/load-generator/internal/smtp"
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/spf13/cobra"
@@ -20,29 +19,26 @@ lg smtp --requestrate 10 http://example.com/some/path
 `,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
-			o := smtp.NewOptions()
+		o := smtp.NewOptions()
 
-			o.Target = args[0]
-			o.Username = smtpUsername
-			o.Password = smtpPassword
-			o.From = smtpFrom
-			o.To = smtpTo
-			o.Subject = smtpSubject
-			o.Data = smtpData
-			o.Plaintext = smtpPlaintext
-			o.Insecure = smtpInsecure
-			o.TlsServerName = smtpTlsServerName
-			o.RootCAs = smtpRootCAs
-			o.DisableConnectionReuse = smtpDisableConnectionReuse
+		o.Target = args[0]
+		o.Username = smtpUsername
+		o.Password = smtpPassword
+		o.From = smtpFrom
+		o.To = smtpTo
+		o.Subject = smtpSubject
+		o.Data = smtpData
+		o.Plaintext = smtpPlaintext
+		o.Insecure = smtpInsecure
+		o.TlsServerName = smtpTlsServerName
+		o.RootCAs = smtpRootCAs
+		o.DisableConnectionReuse = smtpDisableConnectionReuse
 
-			return smtp.NewGenerator(id, *o, cmd.Context(), requestrate, s)
+		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+			return smtp.NewGenerator(id, *o, ctx, requestrate, s)
 		}
 
-		runr := runner.New(requestrate, concurrency, warmup, duration, cmd.Context(), stat, newGenerator)
-		runr.Run()
-
-		return nil
+		return runLoad(cmd.Context(), newGenerator)
 	},
 }
 
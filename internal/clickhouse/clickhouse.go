@@ -3,6 +3,8 @@ package clickhouse
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -13,10 +15,11 @@ import (
 type Generator struct {
 	DB *sql.DB
 
-	log   *logrus.Entry
-	o     GeneratorOptions
-	ctx   context.Context
-	stats *stats.Stats
+	log       *logrus.Entry
+	o         GeneratorOptions
+	ctx       context.Context
+	stats     *stats.Stats
+	scheduled time.Time
 }
 
 type GeneratorOptions struct {
@@ -55,12 +58,14 @@ func (g *Generator) Tick() error {
 	res, err := g.DB.QueryContext(g.ctx, g.o.Query)
 	if err != nil {
 		g.log.Errorf("ClickHouse error: %v", err)
+		g.recordError(start, err)
 		return err // Return the error so it's properly handled
 	}
 
 	err = res.Close()
 	if err != nil {
 		g.log.Errorf("ClickHouse close error: %v", err)
+		g.recordError(start, err)
 		return err
 	}
 
@@ -70,11 +75,47 @@ func (g *Generator) Tick() error {
 	traceInfo.Key = g.o.DSN // Use DSN as the key
 	traceInfo.Subkey = g.o.Query
 	traceInfo.Total = time.Since(start)
+	traceInfo.Scheduled = g.scheduled
 	g.stats.RecordMetric(&traceInfo)
 
 	return nil
 }
 
+func (g *Generator) recordError(start time.Time, err error) {
+	// Don't count cancellation at the end of the run
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	var traceInfo stats.TraceInfo
+	traceInfo.Type = stats.ClickHouseTrace
+	traceInfo.Key = g.o.DSN
+	traceInfo.Subkey = g.o.Query
+	traceInfo.Total = time.Since(start)
+	traceInfo.Scheduled = g.scheduled
+	traceInfo.Error = true
+	traceInfo.ErrorReason = errorReason(err)
+	g.stats.RecordMetric(&traceInfo)
+}
+
+// errorReason gives the name (or the code) of ClickHouse exceptions (ex:
+// UNKNOWN_TABLE), stats.ErrorReason for the others
+func errorReason(err error) string {
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		if exception.Name != "" {
+			return exception.Name
+		}
+		return fmt.Sprintf("code %d", exception.Code)
+	}
+
+	return stats.ErrorReason(err)
+}
+
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
 func (g *Generator) Finish() error {
 	if g.DB != nil {
 		return g.DB.Close()
@@ -24,14 +24,19 @@ const defaultConnectTimeout = 5000 * time.Millisecond
 const defaultWriteTimeout = 5000 * time.Millisecond
 const defaultConsistency = gocql.LocalQuorum
 
+type scheduledcontext string
+
+var scheduled = scheduledcontext("scheduled")
+
 type Generator struct {
-	Session *gocql.Session
-	o       GeneratorOptions
-	log     *logrus.Entry
-	ctx     context.Context
-	stats   *stats.Stats
-	query   *gocql.Query
-	hostKey string
+	Session   *gocql.Session
+	o         GeneratorOptions
+	log       *logrus.Entry
+	ctx       context.Context
+	stats     *stats.Stats
+	query     *gocql.Query
+	hostKey   string
+	scheduled time.Time
 }
 
 type GeneratorOptions struct {
@@ -109,9 +114,11 @@ func (g *Generator) ObserveQuery(ctx context.Context, oq gocql.ObservedQuery) {
 	traceInfo.Subkey = oq.Statement
 	if oq.Err != nil && !errors.Is(oq.Err, context.Canceled) {
 		traceInfo.Error = true
+		traceInfo.ErrorReason = errorReason(oq.Err)
 	}
-	if !traceInfo.Error {
-		traceInfo.Total = oq.End.Sub(oq.Start)
+	traceInfo.Total = oq.End.Sub(oq.Start)
+	if s, ok := ctx.Value(scheduled).(time.Time); ok {
+		traceInfo.Scheduled = s
 	}
 
 	if g.o.TrackMetricsPerNode {
@@ -132,7 +139,14 @@ func (g *Generator) ObserveConnect(oc gocql.ObservedConnect) {
 }
 
 func (g *Generator) Tick() error {
-	return g.query.Exec()
+	// Observer is shared by the session, pass the scheduled time along with
+	// the query
+	ctx := context.WithValue(g.ctx, scheduled, g.scheduled)
+	return g.query.WithContext(ctx).Exec()
+}
+
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
 }
 
 func (g *Generator) Finish() error {
@@ -517,3 +531,18 @@ func addPortSuffix(ips []string, port string) []string {
 	}
 	return targets
 }
+
+// errorReason gives the protocol error code of Cassandra errors (ex: error
+// 0x1000 for unavailable), stats.ErrorReason for the others
+func errorReason(err error) string {
+	var reqErr gocql.RequestError
+	if errors.As(err, &reqErr) {
+		return fmt.Sprintf("error 0x%04x", reqErr.Code())
+	}
+
+	if errors.Is(err, gocql.ErrTimeoutNoResponse) {
+		return stats.ErrorTimeout
+	}
+
+	return stats.ErrorReason(err)
+}
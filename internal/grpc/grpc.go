@@ -3,6 +3,7 @@ package grpc
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -22,6 +23,8 @@ import (
 	"google.golang.org/grpc/metadata"
 	reflectpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
 	"google.golang.org/protobuf/runtime/protoiface"
 )
 
@@ -40,6 +43,7 @@ type Generator struct {
 	ctx        context.Context
 	stats      *stats.Stats
 	log        *logrus.Entry
+	scheduled  time.Time
 }
 
 type GeneratorOptions struct {
@@ -129,7 +133,7 @@ func (g *Generator) InitDone() error {
 
 func (g *Generator) Tick() error {
 	_, err := g.Do(g.o.Method, g.o.Data, g.o.Headers)
-	if err != nil {
+	if err != nil && !errors.Is(err, context.Canceled) {
 		g.log.Errorf("grpc error: %v", err)
 	}
 	return nil
@@ -139,6 +143,10 @@ func (g *Generator) Finish() error {
 	return nil
 }
 
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
 func (g *Generator) Template() (string, error) {
 	svcs, err := g.descSource.ListServices()
 	if err != nil {
@@ -218,6 +226,7 @@ func (h *grpcEventHandler) OnReceiveHeaders(md metadata.MD) {
 
 func (h *grpcEventHandler) OnReceiveResponse(resp protoiface.MessageV1) {
 	h.receiveResponse = time.Now()
+	h.t.ResponseSize += int64(proto.Size(protoadapt.MessageV2Of(resp)))
 	if h.formatter != nil {
 		var err error
 		h.msg, err = h.formatter(resp)
@@ -235,6 +244,7 @@ func (h *grpcEventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD
 	//logrus.Debugf("OnReceiveTrailers : code=%v message=%v", stat.Code(), stat.Message())
 
 	h.t.Error = (stat.Code() != codes.OK)
+	h.t.ErrorReason = stat.Code().String()
 
 	switch stat.Code() {
 	case codes.OK:
@@ -244,19 +254,21 @@ func (h *grpcEventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD
 	case codes.DeadlineExceeded:
 		h.t.Error = true
 		h.t.DeadlineExceeded = true
-		return
 	case codes.Canceled:
 		// Client side cancelation we will ignore (like Ctrl-C)
 		if stat.Message() == "context canceled" {
 			h.t.Error = false
+			return
 		}
-		return
 	case codes.Unavailable:
 		logrus.Warnf("Server unavailable: %v", stat.Message())
-		return
 	default:
 		logrus.Warnf("Error: code=%v: message=%v", stat.Code(), stat.Message())
-		return
+	}
+
+	// Latency of the failed request, if it got to be sent
+	if !h.sendHeaders.IsZero() {
+		h.t.Total = now.Sub(h.sendHeaders)
 	}
 }
 
@@ -280,6 +292,8 @@ func (g *Generator) Do(method string, data string, headers []string) (string, er
 	}
 
 	h.t.Key = g.o.Target
+	h.t.Scheduled = g.scheduled
+	h.t.Sized = true
 
 	// We should handle multiple messages?
 	// TODO: Don't g.getReq everytime
@@ -288,7 +302,21 @@ func (g *Generator) Do(method string, data string, headers []string) (string, er
 		return "", err
 	}
 
-	err = grpcurl.InvokeRPC(ctx, g.descSource, g.clientConn, method, headers, h, reqSupplier)
+	// Sizes of the messages sent
+	sizedReqSupplier := func(m protoiface.MessageV1) error {
+		err := reqSupplier(m)
+		if err == nil {
+			h.t.RequestSize += int64(proto.Size(protoadapt.MessageV2Of(m)))
+		}
+		return err
+	}
+
+	err = grpcurl.InvokeRPC(ctx, g.descSource, g.clientConn, method, headers, h, sizedReqSupplier)
+	// Requests cancelled at the end of the run aren't errors, they are
+	// counted as abandoned if at all (whichever the message of the status)
+	if errors.Is(g.ctx.Err(), context.Canceled) {
+		return "", g.ctx.Err()
+	}
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,357 @@
+// Package htmlreport writes a report as a single HTML file, charts included,
+// that can be viewed offline
+package htmlreport
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/freshworks/load-generator/internal/stats"
+)
+
+// Percentile of the latency charted over time
+const overTimePercentile = 99.0
+
+type field struct {
+	Name  string
+	Value string
+}
+
+type summaryRow struct {
+	Type      string
+	Target    string
+	SubTarget string
+	Values    []string
+}
+
+type resultCharts struct {
+	Name      string
+	Histogram template.HTML
+}
+
+type targetSection struct {
+	Title       string
+	Percentiles template.HTML
+	OverTime    []template.HTML
+	Results     []resultCharts
+}
+
+type page struct {
+	Title          string
+	Generated      string
+	Meta           []field
+	SummaryColumns []string
+	Summary        []summaryRow
+	Targets        []targetSection
+	Report         *stats.Report
+	Queries        []field
+}
+
+// summaryPercentiles gives the percentiles of the results, the same for
+// all of them unless the report merges ones collected differently
+func summaryPercentiles(report *stats.Report) []float64 {
+	var percentiles []float64
+	if len(report.Results) > 0 {
+		for _, p := range report.Results[0].Histogram.Percentiles {
+			percentiles = append(percentiles, p.Percentile)
+		}
+	}
+
+	return percentiles
+}
+
+func summaryColumns(percentiles []float64) []string {
+	columns := []string{"Count", "RPS", "Errors", "Min", "Avg"}
+	for _, p := range percentiles {
+		columns = append(columns, "P"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+
+	return append(columns, "Max", "2xx", "3xx", "4xx", "5xx")
+}
+
+// Write writes the report as HTML: run metadata, a summary table, and for
+// every target the latency percentiles, histograms and metrics over time
+// (when there are interval snapshots), along with the queries of the digests
+func Write(w io.Writer, report *stats.Report) error {
+	t, err := template.New("report").Parse(pageTemplate)
+	if err != nil {
+		return err
+	}
+
+	percentiles := summaryPercentiles(report)
+	p := page{
+		Title:          "Load test report " + report.Id,
+		Generated:      time.Now().Format(time.RFC1123),
+		Meta:           meta(report),
+		SummaryColumns: summaryColumns(percentiles),
+		Report:         report,
+	}
+
+	results := append([]stats.Result(nil), report.Results...)
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.SubTarget < b.SubTarget
+	})
+
+	for i := 0; i < len(results); {
+		j := i
+		for j < len(results) && results[j].Type == results[i].Type && results[j].Target == results[i].Target {
+			j++
+		}
+		p.Targets = append(p.Targets, target(report, results[i:j]))
+		i = j
+	}
+
+	for _, r := range results {
+		p.Summary = append(p.Summary, summary(report, r, percentiles))
+	}
+
+	for d, q := range report.DigestToQuery {
+		p.Queries = append(p.Queries, field{d, q})
+	}
+	sort.Slice(p.Queries, func(i, j int) bool { return p.Queries[i].Name < p.Queries[j].Name })
+
+	return t.Execute(w, p)
+}
+
+func meta(r *stats.Report) []field {
+	m := []field{
+		{"Id", r.Id},
+		{"Start", r.StartTime.Format(time.RFC3339)},
+		{"End", r.EndTime.Format(time.RFC3339)},
+		{"Duration", r.Duration},
+		{"Request rate", strconv.Itoa(r.Requestrate)},
+		{"Concurrency", strconv.Itoa(r.Concurrency)},
+	}
+
+	if r.NumWorkers != nil {
+		m = append(m, field{"Clients", strconv.Itoa(*r.NumWorkers)})
+	}
+	if r.Budget != nil {
+		m = append(m, field{"Budget", r.Budget.String()})
+	}
+	if r.Abandoned != nil {
+		m = append(m, field{"Abandoned requests", strconv.Itoa(*r.Abandoned)})
+	}
+
+	return m
+}
+
+func subTarget(report *stats.Report, r stats.Result) string {
+	if q, ok := report.DigestToQuery[r.SubTarget]; ok {
+		return q
+	}
+
+	return r.SubTarget
+}
+
+func percentile(percentiles []stats.Percentile, q float64) float64 {
+	for _, p := range percentiles {
+		if p.Percentile == q {
+			return p.Value
+		}
+	}
+
+	return 0
+}
+
+func optional(v *int) string {
+	if v == nil {
+		return "-"
+	}
+
+	return strconv.Itoa(*v)
+}
+
+func summary(report *stats.Report, r stats.Result, percentiles []float64) summaryRow {
+	h := r.Histogram
+	ms := stats.FormatLatency
+
+	values := []string{strconv.FormatInt(h.Count, 10), strconv.FormatFloat(r.AvgRPS, 'f', 2, 64), optional(r.Errors), ms(h.Min), ms(h.Avg)}
+	for _, p := range percentiles {
+		values = append(values, ms(percentile(h.Percentiles, p)))
+	}
+	values = append(values, ms(h.Max), optional(r.Status2xx), optional(r.Status3xx), optional(r.Status4xx), optional(r.Status5xx))
+
+	return summaryRow{
+		Type:      r.Type,
+		Target:    r.Target,
+		SubTarget: subTarget(report, r),
+		Values:    values,
+	}
+}
+
+// target charts the results of a target
+func target(report *stats.Report, results []stats.Result) targetSection {
+	unit := "Latency (ms)"
+	if results[0].Type == string(stats.RawTrace) {
+		unit = "Value"
+	}
+
+	s := targetSection{Title: fmt.Sprintf("%s %s", results[0].Type, results[0].Target)}
+
+	percentiles := lineChart{title: "Latency percentiles", xLabel: "Percentile", yLabel: unit}
+	for _, p := range results[0].Histogram.Percentiles {
+		percentiles.labels = append(percentiles.labels, "p"+strconv.FormatFloat(p.Percentile, 'f', -1, 64))
+	}
+
+	var origin time.Time
+	for _, r := range results {
+		if len(r.Intervals) > 0 && (origin.IsZero() || r.Intervals[0].Start.Before(origin)) {
+			origin = r.Intervals[0].Start
+		}
+	}
+	latency := lineChart{title: fmt.Sprintf("p%v over time", overTimePercentile), xLabel: "Time (s)", yLabel: unit}
+	rate := lineChart{title: "Requests per second over time", xLabel: "Time (s)", yLabel: "Requests per second"}
+	errors := lineChart{title: "Errors over time", xLabel: "Time (s)", yLabel: "Errors"}
+
+	for i, r := range results {
+		name := subTarget(report, r)
+		if name == "" {
+			name = r.Target
+		}
+		color := palette[i%len(palette)]
+
+		ps := series{name: name, color: color}
+		for j, p := range r.Histogram.Percentiles {
+			ps.x = append(ps.x, float64(j))
+			ps.y = append(ps.y, p.Value)
+		}
+		percentiles.series = append(percentiles.series, ps)
+
+		if r.Corrected != nil {
+			cs := series{name: name + " (corrected)", color: color, dashed: true}
+			for j, p := range r.Corrected.Percentiles {
+				cs.x = append(cs.x, float64(j))
+				cs.y = append(cs.y, p.Value)
+			}
+			percentiles.series = append(percentiles.series, cs)
+		}
+
+		if len(r.Intervals) > 0 {
+			ls := series{name: name, color: color}
+			rs := series{name: name, color: color}
+			es := series{name: name, color: color}
+			for _, in := range r.Intervals {
+				x := in.Start.Sub(origin).Seconds()
+				ls.x = append(ls.x, x)
+				ls.y = append(ls.y, percentile(in.Percentiles, overTimePercentile))
+				rs.x = append(rs.x, x)
+				rs.y = append(rs.y, in.RPS)
+				es.x = append(es.x, x)
+				es.y = append(es.y, float64(in.Errors))
+			}
+			latency.series = append(latency.series, ls)
+			rate.series = append(rate.series, rs)
+			errors.series = append(errors.series, es)
+		}
+
+		hist := barChart{title: "Latency histogram: " + name, xLabel: unit, yLabel: "Requests", color: color}
+		for _, b := range r.Histogram.Data {
+			hist.bars = append(hist.bars, bar{strconv.FormatFloat(b.Interval, 'f', 1, 64), float64(b.Count)})
+		}
+		s.Results = append(s.Results, resultCharts{Name: name, Histogram: hist.svg()})
+	}
+
+	s.Percentiles = percentiles.svg()
+	if len(latency.series) > 0 {
+		s.OverTime = []template.HTML{latency.svg(), rate.svg(), errors.svg()}
+	}
+
+	return s
+}
+
+const pageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <style>
+    body { font-family: sans-serif; font-size: 14px; margin: 2em; color: #222; }
+    table { border-collapse: collapse; margin-bottom: 1.5em; }
+    th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; }
+    th { background-color: #f2f2f2; }
+    tr:nth-child(even) td { background-color: #fafafa; }
+    td.num { text-align: right; }
+    svg { margin: 0.5em 1em 0.5em 0; }
+    svg text { font-family: sans-serif; font-size: 11px; fill: #333; }
+    svg .title { font-size: 14px; text-anchor: middle; }
+    svg .label { text-anchor: middle; }
+    svg .xtick { text-anchor: middle; }
+    svg .ytick { text-anchor: end; }
+    svg .grid { stroke: #eee; }
+    svg .axis { stroke: #888; }
+    code { white-space: pre-wrap; }
+  </style>
+</head>
+<body>
+  <h1>{{.Title}}</h1>
+  <p>Generated {{.Generated}}</p>
+
+  <h2>Run</h2>
+  <table>
+  {{- range .Meta}}
+    <tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+  {{- end}}
+  </table>
+
+  {{- with .Report.Stages}}
+  <h3>Stages</h3>
+  <table>
+    <tr><th>Start</th><th>Duration</th><th>From (rps)</th><th>Target (rps)</th></tr>
+    {{- range .}}
+    <tr><td>{{.Start.Format "15:04:05"}}</td><td>{{.Duration}}</td><td class="num">{{.From}}</td><td class="num">{{.Target}}</td></tr>
+    {{- end}}
+  </table>
+  {{- end}}
+
+  {{- with .Report.Workers}}
+  <h3>Workers</h3>
+  <table>
+    <tr><th>Time</th><th>Workers</th><th>Event</th></tr>
+    {{- range .}}
+    <tr><td>{{.Time.Format "15:04:05"}}</td><td class="num">{{.Workers}}</td><td>{{.Event}}</td></tr>
+    {{- end}}
+  </table>
+  {{- end}}
+
+  <h2>Summary</h2>
+  <p>Latencies in milliseconds</p>
+  <table>
+    <tr><th>Type</th><th>Target</th><th>Subtarget</th>{{range .SummaryColumns}}<th>{{.}}</th>{{end}}</tr>
+    {{- range .Summary}}
+    <tr><td>{{.Type}}</td><td>{{.Target}}</td><td><code>{{.SubTarget}}</code></td>{{range .Values}}<td class="num">{{.}}</td>{{end}}</tr>
+    {{- end}}
+  </table>
+
+  {{- range .Targets}}
+  <h2>{{.Title}}</h2>
+  <div>{{.Percentiles}}</div>
+  {{- with .OverTime}}
+  <div>{{range .}}{{.}}{{end}}</div>
+  {{- end}}
+  <div>{{range .Results}}{{.Histogram}}{{end}}</div>
+  {{- end}}
+
+  {{- with .Queries}}
+  <h2>Queries</h2>
+  <table>
+    <tr><th>Digest</th><th>Query</th></tr>
+    {{- range .}}
+    <tr><td>{{.Name}}</td><td><code>{{.Value}}</code></td></tr>
+    {{- end}}
+  </table>
+  {{- end}}
+</body>
+</html>
+`
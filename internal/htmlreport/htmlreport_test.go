@@ -0,0 +1,60 @@
+package htmlreport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freshworks/load-generator/internal/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	errors := 3
+	percentiles := []stats.Percentile{{Percentile: 50, Value: 10}, {Percentile: 99, Value: 40}}
+	report := &stats.Report{
+		Id:          "run-1",
+		Requestrate: 100,
+		Concurrency: 10,
+		Duration:    "1m0s",
+		StartTime:   start,
+		EndTime:     start.Add(time.Minute),
+		Workers:     []stats.WorkerEvent{{Time: start, Workers: 10, Event: stats.WorkersStarted}},
+		Results: []stats.Result{
+			{
+				Type:      string(stats.SqlTrace),
+				Target:    "db",
+				SubTarget: "abc123",
+				AvgRPS:    100,
+				Errors:    &errors,
+				Histogram: stats.HistogramData{Count: 6000, Avg: 12, Percentiles: percentiles,
+					Data: []stats.Bucket{{Interval: 10, Count: 5000}, {Interval: 40, Count: 1000}}},
+				Intervals: []stats.Interval{
+					{Start: start, Count: 3000, RPS: 100, Percentiles: percentiles},
+					{Start: start.Add(30 * time.Second), Count: 3000, RPS: 100, Errors: 3, Percentiles: percentiles},
+				},
+			},
+		},
+		DigestToQuery: map[string]string{"abc123": "SELECT * FROM t WHERE id = ?"},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, report))
+	html := out.String()
+
+	assert.Contains(t, html, "<title>Load test report run-1</title>")
+	assert.Contains(t, html, "<th>Concurrency</th><td>10</td>")
+	assert.Contains(t, html, "<td>started</td>")
+	assert.Contains(t, html, "<code>SELECT * FROM t WHERE id = ?</code>")
+	assert.Contains(t, html, `<td class="num">6000</td>`)
+	assert.Equal(t, 5, strings.Count(html, "<svg"))
+	assert.Contains(t, html, `class="title">Latency percentiles</text>`)
+	assert.Contains(t, html, `class="title">p99 over time</text>`)
+	assert.Contains(t, html, `<title>40.0: 1000</title>`)
+	// Offline
+	assert.NotContains(t, html, "<script")
+	assert.NotContains(t, html, "https://")
+}
@@ -0,0 +1,210 @@
+package htmlreport
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Charts are drawn as inline SVG, so that the report doesn't need anything
+// but the file
+
+const (
+	chartWidth  = 720
+	chartHeight = 300
+	marginLeft  = 70
+	marginRight = 20
+	marginTop   = 30
+	marginBot   = 50
+)
+
+// Set2 palette
+var palette = []string{"#66c2a5", "#fc8d62", "#8da0cb", "#e78ac3", "#a6d854", "#ffd92f", "#e5c494", "#b3b3b3"}
+
+type series struct {
+	name   string
+	color  string
+	dashed bool
+	x      []float64
+	y      []float64
+}
+
+// lineChart plots series of points, x is either numeric or, if labels are
+// given, the index of the label
+type lineChart struct {
+	title  string
+	xLabel string
+	yLabel string
+	labels []string
+	series []series
+}
+
+// niceStep gives a round step (1, 2 or 5 times a power of 10) to have about
+// n ticks up to max
+func niceStep(max float64, n int) float64 {
+	if max <= 0 {
+		return 1
+	}
+
+	raw := max / float64(n)
+	p := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*p >= raw {
+			return m * p
+		}
+	}
+
+	return 10 * p
+}
+
+// formatTick formats a tick value, without the float noise of the steps
+func formatTick(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+}
+
+func (c lineChart) svg() template.HTML {
+	minX, maxX, maxY := math.Inf(1), math.Inf(-1), 0.0
+	for _, s := range c.series {
+		for i := range s.x {
+			minX = math.Min(minX, s.x[i])
+			maxX = math.Max(maxX, s.x[i])
+			maxY = math.Max(maxY, s.y[i])
+		}
+	}
+	if len(c.labels) > 0 {
+		minX, maxX = 0, float64(len(c.labels)-1)
+	}
+	if math.IsInf(minX, 0) {
+		minX, maxX = 0, 1
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+
+	yStep := niceStep(maxY, 5)
+	maxY = math.Max(yStep, math.Ceil(maxY/yStep)*yStep)
+
+	w := float64(chartWidth - marginLeft - marginRight)
+	h := float64(chartHeight - marginTop - marginBot)
+	px := func(x float64) float64 { return marginLeft + (x-minX)/(maxX-minX)*w }
+	py := func(y float64) float64 { return marginTop + h - y/maxY*h }
+
+	var b strings.Builder
+	c.header(&b)
+
+	yGrid(&b, yStep, maxY, py)
+
+	if len(c.labels) > 0 {
+		for i, l := range c.labels {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="xtick">%s</text>`, px(float64(i)), chartHeight-marginBot+16, template.HTMLEscapeString(l))
+		}
+	} else {
+		xStep := niceStep(maxX-minX, 8)
+		first := math.Ceil(minX / xStep)
+		for i := 0.0; (first+i)*xStep <= maxX; i++ {
+			x := (first + i) * xStep
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="xtick">%s</text>`, px(x), chartHeight-marginBot+16, formatTick(x))
+		}
+	}
+
+	for _, s := range c.series {
+		points := make([]string, 0, len(s.x))
+		circles := make([]string, 0, len(s.x))
+		for i := range s.x {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", px(s.x[i]), py(s.y[i])))
+			circles = append(circles, fmt.Sprintf(`<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`, px(s.x[i]), py(s.y[i]), s.color))
+		}
+
+		dash := ""
+		if s.dashed {
+			dash = ` stroke-dasharray="6,4"`
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"%s/>`, strings.Join(points, " "), s.color, dash)
+		b.WriteString(strings.Join(circles, ""))
+	}
+
+	c.axes(&b)
+	c.legend(&b)
+	b.WriteString(`</svg>`)
+
+	return template.HTML(b.String())
+}
+
+// yGrid draws the horizontal grid lines and the y ticks, from 0 to maxY
+func yGrid(b *strings.Builder, yStep, maxY float64, py func(float64) float64) {
+	for i := 0; float64(i)*yStep <= maxY+yStep/2; i++ {
+		y := float64(i) * yStep
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`, marginLeft, py(y), chartWidth-marginRight, py(y))
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" class="ytick">%s</text>`, marginLeft-6, py(y)+4, formatTick(y))
+	}
+}
+
+func (c lineChart) header(b *strings.Builder) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(b, `<text x="%d" y="18" class="title">%s</text>`, chartWidth/2, template.HTMLEscapeString(c.title))
+}
+
+func (c lineChart) axes(b *strings.Builder) {
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, marginLeft, marginTop, marginLeft, chartHeight-marginBot)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, marginLeft, chartHeight-marginBot, chartWidth-marginRight, chartHeight-marginBot)
+	fmt.Fprintf(b, `<text x="%d" y="%d" class="label">%s</text>`, marginLeft+(chartWidth-marginLeft-marginRight)/2, chartHeight-marginBot+34, template.HTMLEscapeString(c.xLabel))
+	fmt.Fprintf(b, `<text x="14" y="%d" class="label" transform="rotate(-90 14 %d)">%s</text>`, marginTop+(chartHeight-marginTop-marginBot)/2, marginTop+(chartHeight-marginTop-marginBot)/2, template.HTMLEscapeString(c.yLabel))
+}
+
+func (c lineChart) legend(b *strings.Builder) {
+	for i, s := range c.series {
+		y := marginTop + 4 + i*16
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, marginLeft+10, y, s.color)
+		fmt.Fprintf(b, `<text x="%d" y="%d" class="legend">%s</text>`, marginLeft+24, y+9, template.HTMLEscapeString(s.name))
+	}
+}
+
+type bar struct {
+	label string
+	value float64
+}
+
+// barChart draws a bar per value
+type barChart struct {
+	title  string
+	xLabel string
+	yLabel string
+	color  string
+	bars   []bar
+}
+
+func (c barChart) svg() template.HTML {
+	maxY := 0.0
+	for _, b := range c.bars {
+		maxY = math.Max(maxY, b.value)
+	}
+	yStep := niceStep(maxY, 5)
+	maxY = math.Max(yStep, math.Ceil(maxY/yStep)*yStep)
+
+	w := float64(chartWidth - marginLeft - marginRight)
+	h := float64(chartHeight - marginTop - marginBot)
+	py := func(y float64) float64 { return marginTop + h - y/maxY*h }
+
+	lc := lineChart{title: c.title, xLabel: c.xLabel, yLabel: c.yLabel}
+	var b strings.Builder
+	lc.header(&b)
+
+	yGrid(&b, yStep, maxY, py)
+
+	if n := len(c.bars); n > 0 {
+		slot := w / float64(n)
+		for i, v := range c.bars {
+			x := marginLeft + float64(i)*slot
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+				x+slot*0.1, py(v.value), slot*0.8, py(0)-py(v.value), c.color, template.HTMLEscapeString(v.label), formatTick(v.value))
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="xtick">%s</text>`, x+slot/2, chartHeight-marginBot+16, template.HTMLEscapeString(v.label))
+		}
+	}
+
+	lc.axes(&b)
+	b.WriteString(`</svg>`)
+
+	return template.HTML(b.String())
+}
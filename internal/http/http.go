@@ -42,6 +42,7 @@ type Generator struct {
 	ctx       context.Context
 	stats     *stats.Stats
 	awsSigner *awssigner.Signer
+	scheduled time.Time
 }
 
 type GeneratorOptions struct {
@@ -181,7 +182,7 @@ func (g *Generator) InitDone() error { return nil }
 
 func (g *Generator) Tick() error {
 	_, err := g.Do(g.options.Method, g.url, nil, g.options.Data)
-	if err != nil {
+	if err != nil && !errors.Is(err, context.Canceled) {
 		g.log.Errorf("http error: %v", err)
 	}
 
@@ -190,6 +191,10 @@ func (g *Generator) Tick() error {
 
 func (g *Generator) Finish() error { return nil }
 
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
 func (g *Generator) Do(method string, Url string, headers map[string]string,
 	body string) (*http.Response, error) {
 
@@ -305,6 +310,7 @@ func (g *Generator) do(method string, urlStr string, headers map[string]string,
 	traceInfo.Type = stats.HttpTrace
 	traceInfo.Key = fmt.Sprintf("%s://%s", req.URL.Scheme, req.URL.Host)
 	traceInfo.Subkey = req.URL.Path
+	traceInfo.Scheduled = g.scheduled
 
 	if g.options.PrintCurl {
 		cmd, err := http2curl.GetCurlCommand(req)
@@ -317,26 +323,45 @@ func (g *Generator) do(method string, urlStr string, headers map[string]string,
 
 	resp, err := g.client.Do(req)
 	if err != nil {
+		// Requests cancelled at the end of the run aren't errors, they
+		// are counted as abandoned if at all
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+
 		traceInfo.Error = true
+		traceInfo.ErrorReason = stats.ErrorReason(err)
+		if !startTime.IsZero() {
+			traceInfo.Total = time.Since(startTime)
+		}
 		g.stats.RecordMetric(&traceInfo)
 		return nil, err
 	}
 
 	if resp != nil {
+		// Body sizes, streamed responses aren't read here so only their
+		// announced length is known
+		traceInfo.Sized = true
+		traceInfo.RequestSize = int64(len(body))
+		if resp.ContentLength > 0 {
+			traceInfo.ResponseSize = resp.ContentLength
+		}
+
 		if resp.Body != nil {
 			if !g.options.StreamResponse {
 				if g.options.DiscardResponse {
-					io.Copy(ioutil.Discard, resp.Body)
+					traceInfo.ResponseSize, _ = io.Copy(ioutil.Discard, resp.Body)
 					resp.Body.Close()
 				} else {
 					// TODO: Handle large responses, we could run out of
 					// memory with the current method.
 
 					// Make a copy of the response
-					b, _, err := copyReader(resp.Body, resp.ContentLength)
+					b, n, err := copyReader(resp.Body, resp.ContentLength)
 					if err != nil {
 						g.log.Warnf("Failed to read the response body: %v", err)
 					}
+					traceInfo.ResponseSize = n
 					resp.Body.Close()
 					resp.Body = b
 				}
@@ -96,6 +96,23 @@ func TestGenerator(t *testing.T) {
 		assert.Equal(t, int64(1), r.Histogram.Count)
 	})
 
+	t.Run("ByteMetrics", func(t *testing.T) {
+		g := setup(u)
+		err = g.Init()
+		assert.Nil(t, err)
+		sts.Reset()
+
+		_, err := g.Do("POST", u.String()+"/hello", nil, "hello=world")
+		assert.Nil(t, err)
+
+		r := getStatResultFor(sts, u.String(), "/hello")
+		require.NotNil(t, r)
+		require.NotNil(t, r.Bytes)
+		assert.Equal(t, int64(11), r.Bytes.RequestBytes)
+		assert.Equal(t, int64(17), r.Bytes.ResponseBytes)
+		assert.Equal(t, 17.0, r.Bytes.ResponseSize.Max)
+	})
+
 	t.Run("DoFormUrl", func(t *testing.T) {
 		g := setup(u)
 
@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"time"
 
@@ -21,6 +22,7 @@ type Generator struct {
 	stats      *stats.Stats
 	ctx        context.Context
 	requestrate int
+	scheduled  time.Time
 }
 
 type GeneratorOptions struct {
@@ -184,6 +186,8 @@ func (k *Generator) InitDone() error {
 func (k *Generator) Tick() error {
 	startTime := time.Now()
 	var err error
+	// Payload bytes written or read
+	var requestSize, responseSize int64
 
 	// For load testing, we'll use a very short timeout to avoid blocking
 	timeoutCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
@@ -208,6 +212,7 @@ func (k *Generator) Tick() error {
 			if readErr == nil {
 				// We actually got a message
 				k.log.Debugf("Message read: %s", string(message.Value))
+				responseSize = int64(len(message.Key) + len(message.Value))
 			}
 		}
 		
@@ -219,6 +224,7 @@ func (k *Generator) Tick() error {
 		err = nil
 	} else {
 		// Write messages
+		requestSize = int64(len(k.o.MessageKey) + len(k.o.MessageValue))
 		err = k.writer.WriteMessages(timeoutCtx,
 			kafka.Message{
 				Key:   []byte(k.o.MessageKey),
@@ -233,6 +239,11 @@ func (k *Generator) Tick() error {
 
 	// Record metrics
 	var traceInfo stats.TraceInfo
+	if err == nil {
+		traceInfo.Sized = true
+		traceInfo.RequestSize = requestSize
+		traceInfo.ResponseSize = responseSize
+	}
 	traceInfo.Type = stats.CustomTrace
 	traceInfo.Key = fmt.Sprintf("%v", k.o.Brokers)
 	if k.o.ReadMessages {
@@ -241,15 +252,21 @@ func (k *Generator) Tick() error {
 		traceInfo.Subkey = fmt.Sprintf("write:%s", k.o.Topic)
 	}
 	traceInfo.Total = time.Since(startTime)
+	traceInfo.Scheduled = k.scheduled
 
 	if err != nil {
 		traceInfo.Error = true
+		traceInfo.ErrorReason = errorReason(err)
 	}
 
 	k.stats.RecordMetric(&traceInfo)
 	return err
 }
 
+func (k *Generator) SetScheduledTime(t time.Time) {
+	k.scheduled = t
+}
+
 func (k *Generator) Finish() error {
 	if k.writer != nil {
 		if err := k.writer.Close(); err != nil {
@@ -265,3 +282,24 @@ func (k *Generator) Finish() error {
 
 	return nil
 }
+
+// errorReason gives the title of Kafka errors (ex: Leader Not Available),
+// of the first message for write errors, stats.ErrorReason for the others
+func errorReason(err error) string {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		for _, e := range writeErrs {
+			if e != nil {
+				err = e
+				break
+			}
+		}
+	}
+
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Title()
+	}
+
+	return stats.ErrorReason(err)
+}
@@ -2,6 +2,9 @@ package loadgen
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/freshworks/load-generator/internal/stats"
 	log "github.com/sirupsen/logrus"
@@ -14,6 +17,27 @@ type Generator interface {
 	Finish() error
 }
 
+// ScheduledGenerator is implemented by generators which can report latency
+// from the time a tick was scheduled at, rather than from the time it was
+// picked up by the worker (see stats.TraceInfo.Scheduled)
+type ScheduledGenerator interface {
+	SetScheduledTime(t time.Time)
+}
+
+// PacedGenerator is implemented by generators which can pace their ticks
+// themselves (ex: replaying timestamped data), the runner then hands them
+// ticks as soon as they are free rather than at the request rate
+type PacedGenerator interface {
+	Paced() bool
+}
+
+// StoppableGenerator is implemented by generators which can wait within a
+// tick for something else than their requests (ex: the time of replayed
+// data), Stop makes them stop waiting once the run is stopped
+type StoppableGenerator interface {
+	Stop()
+}
+
 type NewGenerator func(id int, requestrate int, concurrency int, ctx context.Context, stat *stats.Stats) Generator
 
 type LoadGenerator struct {
@@ -21,6 +45,17 @@ type LoadGenerator struct {
 	log       *log.Entry
 	generator Generator
 	ctx       context.Context
+	quit      chan struct{}
+	quitOnce  sync.Once
+
+	// Iteration budget shared by all workers (remaining ticks) and the
+	// budget of this worker
+	budget     *atomic.Int64
+	iterations int
+	ticks      int
+	err        error
+
+	busy atomic.Bool
 }
 
 func NewLoadGenerator(id int, requestrate int, concurrency int, newGenerator NewGenerator, workCh chan interface{}, ctx context.Context, s *stats.Stats) *LoadGenerator {
@@ -28,6 +63,7 @@ func NewLoadGenerator(id int, requestrate int, concurrency int, newGenerator New
 		workChan:  workCh,
 		log:       log.WithFields(log.Fields{"Id": id}),
 		ctx:       ctx,
+		quit:      make(chan struct{}),
 		generator: newGenerator(id, requestrate, concurrency, ctx, s),
 	}
 }
@@ -43,24 +79,98 @@ func (lg *LoadGenerator) Run() {
 	}
 
 	lg.log.Debugf("Starting run")
+	lg.err = nil
 
 out:
 	for {
+		// Don't pick up any more work once stopped
+		select {
+		case <-lg.quit:
+			break out
+		default:
+		}
+
 		select {
-		case <-lg.workChan:
+		case t := <-lg.workChan:
+			if lg.budget != nil && lg.budget.Add(-1) < 0 {
+				lg.log.Debugf("Iteration budget done")
+				break out
+			}
+
+			if sg, ok := lg.generator.(ScheduledGenerator); ok {
+				// Ticks without a schedule (no rate control) are nil
+				st, _ := t.(time.Time)
+				sg.SetScheduledTime(st)
+			}
+
+			lg.busy.Store(true)
 			err := lg.generator.Tick()
+			lg.busy.Store(false)
+			lg.ticks++
 			if err != nil {
 				lg.log.Warnf("%v", err)
+				lg.err = err
+				break out
+			}
+
+			if lg.iterations > 0 && lg.ticks >= lg.iterations {
+				lg.log.Debugf("Iteration budget done")
 				break out
 			}
 		case <-lg.ctx.Done():
 			break out
+		case <-lg.quit:
+			break out
 		}
 	}
 
 	lg.log.Debugf("Exiting run")
 }
 
+// Paced tells whether the generator paces its ticks itself, valid once
+// initialized
+func (lg *LoadGenerator) Paced() bool {
+	pg, ok := lg.generator.(PacedGenerator)
+	return ok && pg.Paced()
+}
+
+// Stop makes Run return once the current tick, if any, is done
+func (lg *LoadGenerator) Stop() {
+	lg.quitOnce.Do(func() {
+		close(lg.quit)
+		if sg, ok := lg.generator.(StoppableGenerator); ok {
+			sg.Stop()
+		}
+	})
+}
+
+// Busy tells whether a tick is in progress
+func (lg *LoadGenerator) Busy() bool {
+	return lg.busy.Load()
+}
+
+// SetBudget makes workers sharing the budget stop once it has no remaining
+// ticks, it has to be set before Run
+func (lg *LoadGenerator) SetBudget(remaining *atomic.Int64) {
+	lg.budget = remaining
+}
+
+// SetIterations makes Run return after n ticks, it has to be set before Run
+func (lg *LoadGenerator) SetIterations(n int) {
+	lg.iterations = n
+}
+
+// Ticks is the number of ticks done, valid once Run returned
+func (lg *LoadGenerator) Ticks() int {
+	return lg.ticks
+}
+
+// Err is the error from Tick which made Run return, if any. Valid once Run
+// returned.
+func (lg *LoadGenerator) Err() error {
+	return lg.err
+}
+
 func (lg *LoadGenerator) Finish() error {
 	lg.log.Debugf("Calling finish for generator: %T", lg.generator)
 	return lg.generator.Finish()
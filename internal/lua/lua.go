@@ -39,21 +39,31 @@ type GeneratorOptions struct {
 	Script string
 	Args   []string
 	Debug  bool
+	// Speed factor of the tick data replay (see LG.SetTickDataTimestamp)
+	ReplaySpeed float64
 }
 
 func NewOptions() *GeneratorOptions {
-	return &GeneratorOptions{}
+	return &GeneratorOptions{
+		ReplaySpeed: 1,
+	}
 }
 
 func NewGenerator(o GeneratorOptions, id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) *Generator {
 	log := logrus.WithFields(logrus.Fields{"Id": id})
 
+	lg := NewLG(id, requestrate, concurrency, ctx, o.Script, s, log)
+	lg.replaySpeed = o.ReplaySpeed
+	if lg.replaySpeed <= 0 {
+		lg.replaySpeed = 1
+	}
+
 	return &Generator{
 		Script:      o.Script,
 		Args:        o.Args,
 		log:         log,
 		requestrate: requestrate,
-		LG:          NewLG(id, requestrate, concurrency, ctx, o.Script, s, log),
+		LG:          lg,
 		o:           o,
 	}
 }
@@ -110,10 +120,39 @@ func (l *Generator) InitDone() error {
 }
 
 func (l *Generator) Tick() error {
-	d := l.LG.getTickData()
+	d, due, ok := l.LG.getTickData()
+	if !ok {
+		// Stopped while waiting for the row, it's never sent
+		return nil
+	}
+	if !due.IsZero() {
+		// Replayed rows are scheduled at the time of their timestamp
+		l.LG.setScheduledTime(due)
+	}
 	return l.callTickFn(d)
 }
 
+// Paced tells whether the tick data is replayed at the pace of its
+// timestamps, rather than at the request rate
+func (l *Generator) Paced() bool {
+	tickDataMux.Lock()
+	defer tickDataMux.Unlock()
+
+	return tickDataFile != "" && tickReplay != nil
+}
+
+// SetScheduledTime makes the requests of the next tick, from any of the
+// clients of the script, report latency from t as well
+func (l *Generator) SetScheduledTime(t time.Time) {
+	l.LG.setScheduledTime(t)
+}
+
+// Stop stops waiting for the next replayed row, so that the run doesn't wait
+// for it to be due (or for the stop timeout)
+func (l *Generator) Stop() {
+	l.LG.stopped()
+}
+
 func (l *Generator) Finish() error {
 	l.LG.finish()
 	return l.callFinishFn()
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/csv"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -16,6 +17,7 @@ import (
 	"github.com/freshworks/load-generator/internal/cql"
 	"github.com/freshworks/load-generator/internal/grpc"
 	"github.com/freshworks/load-generator/internal/http"
+	"github.com/freshworks/load-generator/internal/loadgen"
 	"github.com/freshworks/load-generator/internal/mongo"
 	"github.com/freshworks/load-generator/internal/mysql"
 	"github.com/freshworks/load-generator/internal/psql"
@@ -35,6 +37,7 @@ var (
 	tickDataFile           string
 	tickFile               *os.File
 	tickReader             interface{}
+	tickReplay             *replay
 	loadTickDataInitOnce   sync.Once
 	loadTickDataFinishOnce sync.Once
 )
@@ -52,10 +55,19 @@ type LG struct {
 	ScriptDir   string
 	ScriptArgs  *lua.LTable
 
+	replaySpeed            float64
 	log                    *logrus.Entry
 	stats                  *stats.Stats
 	ctx                    context.Context
 	customMetricsCollector map[string]time.Time
+
+	// Closed once the run is stopped, to stop waiting for replayed rows
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// Clients created by the script, measuring their requests from the
+	// time the tick was scheduled at
+	clients []loadgen.ScheduledGenerator
 }
 
 func NewLG(id int, requestrate int, concurrency int, ctx context.Context, script string, s *stats.Stats, log *logrus.Entry) *LG {
@@ -69,6 +81,7 @@ func NewLG(id int, requestrate int, concurrency int, ctx context.Context, script
 		ScriptDir:              sd,
 		ctx:                    ctx,
 		customMetricsCollector: make(map[string]time.Time),
+		stop:                   make(chan struct{}),
 		stats:                  s,
 		log:                    log,
 	}
@@ -82,6 +95,13 @@ func (lg *LG) init() error {
 	return nil
 }
 
+// stopped stops the waits for replayed rows
+func (lg *LG) stopped() {
+	lg.stopOnce.Do(func() {
+		close(lg.stop)
+	})
+}
+
 func (lg *LG) finish() error {
 	loadTickDataFinishOnce.Do(func() {
 		lg.finishTickData()
@@ -100,6 +120,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *grpc.GeneratorOptions) (*grpc.Generator, error) {
 				g := grpc.NewGenerator(lg.Id, *o, lg.ctx, lg.stats, lg.RequestRate)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -115,6 +136,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *http.GeneratorOptions) (*http.Generator, error) {
 				g := http.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -130,6 +152,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *redis.GeneratorOptions) (*redis.Generator, error) {
 				g := redis.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -145,6 +168,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *mysql.GeneratorOptions) (*mysql.Generator, error) {
 				g := mysql.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -160,6 +184,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *cql.GeneratorOptions) (*cql.Generator, error) {
 				g := cql.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -175,6 +200,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *psql.GeneratorOptions) (*psql.Generator, error) {
 				g := psql.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -190,6 +216,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *smtp.GeneratorOptions) (*smtp.Generator, error) {
 				g := smtp.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -205,6 +232,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *mongo.GeneratorOptions) (*mongo.Generator, error) {
 				g := mongo.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -220,6 +248,7 @@ func (lg *LG) preloadModules(L *lua.LState) {
 		mod.RawSetString("New", luar.New(L,
 			func(o *clickhouse.GeneratorOptions) (*clickhouse.Generator, error) {
 				g := clickhouse.NewGenerator(lg.Id, *o, lg.ctx, lg.RequestRate, lg.stats)
+				lg.addClient(g)
 				return g, g.Init()
 			}))
 		L.Push(mod)
@@ -227,6 +256,19 @@ func (lg *LG) preloadModules(L *lua.LState) {
 	})
 }
 
+func (lg *LG) addClient(c loadgen.ScheduledGenerator) {
+	lg.clients = append(lg.clients, c)
+}
+
+// setScheduledTime passes the time the tick was scheduled at on to the
+// clients of the script, the requests they make during the tick are measured
+// from it
+func (lg *LG) setScheduledTime(t time.Time) {
+	for _, c := range lg.clients {
+		c.SetScheduledTime(t)
+	}
+}
+
 func (lg *LG) BeginCustomMetrics(keys ...string) {
 	for _, v := range keys {
 		lg.customMetricsCollector[v] = time.Now()
@@ -265,11 +307,9 @@ func (lg *LG) prepareReportCustomMetric(err bool, keys ...string) error {
 				Type:   stats.CustomTrace,
 				Key:    "custom",
 				Subkey: v,
+				Total:  time.Since(s),
 				Error:  err,
 			}
-			if !ti.Error {
-				ti.Total = time.Since(s)
-			}
 			lg.stats.RecordMetric(ti)
 			delete(lg.customMetricsCollector, v)
 		} else {
@@ -288,6 +328,8 @@ func (lg *LG) ShouldQuit() bool {
 	select {
 	case <-lg.ctx.Done():
 		return true
+	case <-lg.stop:
+		return true
 	default:
 		return false
 	}
@@ -298,6 +340,25 @@ func (lg *LG) SetTickDataFile(f string) {
 	defer tickDataMux.Unlock()
 
 	tickDataFile = f
+	tickReplay = nil
+}
+
+// SetTickDataTimestamp replays the tick data file at the pace of its
+// timestamps: each row (or line) is handed to tick() once as much time has
+// passed since the first one as between their timestamps, divided by
+// --replay-speed. column is the (1 based) CSV column, or whitespace separated
+// field of a line, holding the timestamp. layout is "unix" (seconds,
+// fractional allowed), "unixms" or a Go time layout, RFC3339 if empty.
+func (lg *LG) SetTickDataTimestamp(column int, layout string) error {
+	if column < 1 {
+		return fmt.Errorf("invalid timestamp column %d, columns start at 1", column)
+	}
+
+	tickDataMux.Lock()
+	defer tickDataMux.Unlock()
+
+	tickReplay = &replay{column: column - 1, layout: layout}
+	return nil
 }
 
 func (lg *LG) finishTickData() {
@@ -326,16 +387,45 @@ func (lg *LG) initTickData() {
 	} else {
 		tickReader = bufio.NewReader(tickFile)
 	}
+
+	if tickReplay != nil {
+		tickReplay.speed = lg.replaySpeed
+		lg.log.Infof("Replaying %v at %vx speed", tickDataFile, tickReplay.speed)
+	}
 }
 
-func (lg *LG) getTickData() interface{} {
+// getTickData gives the next row (or line) of the tick data file, waiting for
+// its time when the file is replayed, and the time it was due at (zero if not
+// replayed). It gives false if the run was stopped before the row was due.
+func (lg *LG) getTickData() (interface{}, time.Time, bool) {
 	if tickReader == nil {
-		return nil
+		return nil, time.Time{}, true
 	}
 
 	tickDataMux.Lock()
-	defer tickDataMux.Unlock()
+	data := lg.readTickData()
+	var due time.Time
+	if tickReplay != nil && data != nil {
+		due = tickReplay.due(data, lg.log)
+	}
+	tickDataMux.Unlock()
+
+	if d := time.Until(due); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-lg.stop:
+			return nil, time.Time{}, false
+		case <-lg.ctx.Done():
+			return nil, time.Time{}, false
+		}
+	}
 
+	return data, due, true
+}
+
+func (lg *LG) readTickData() interface{} {
 	iter := 0
 	for iter <= 1 {
 		iter++
@@ -348,6 +438,9 @@ func (lg *LG) getTickData() interface{} {
 					lg.log.Debugf("Error reading tick data file (%v): %v\n", tickDataFile, err)
 				}
 				tickFile.Seek(0, io.SeekStart)
+				if tickReplay != nil {
+					tickReplay.rewind()
+				}
 				continue
 			}
 			return data
@@ -359,6 +452,9 @@ func (lg *LG) getTickData() interface{} {
 				}
 				tickFile.Seek(0, io.SeekStart)
 				v.Reset(tickFile)
+				if tickReplay != nil {
+					tickReplay.rewind()
+				}
 				continue
 			}
 			return strings.TrimSuffix(line, "\n")
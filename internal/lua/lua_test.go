@@ -316,6 +316,9 @@ func TestScriptGenerator(t *testing.T) {
 
                       assert(type(LG.SetTickDataFile) == "function", "LG.SetTickDataFile")
                       assert(LG:SetTickDataFile("something") == nil, "LG:SetTickDataFile")
+
+                      assert(type(LG.SetTickDataTimestamp) == "function", "LG.SetTickDataTimestamp")
+                      assert(LG:SetTickDataTimestamp(1, "unix") == nil, "LG:SetTickDataTimestamp")
                    end
 
                    function tick()
@@ -390,6 +393,54 @@ func TestScriptGenerator(t *testing.T) {
 		assert.Nil(err)
 	})
 
+	t.Run("API/LG/Http/Scheduled", func(t *testing.T) {
+		script := `
+                           local http = require('http')
+                           local http_client = nil
+
+	                   function init()
+			      http_client, err = http.New(http.Options())
+			      return err
+			   end
+
+			   function tick()
+                              local resp, err = http_client:Do("GET", "{{.Target}}" .. "/scheduled", nil, "")
+                              assert(err == nil, "Error making request")
+			   end
+`
+
+		var s bytes.Buffer
+		tl, err := template.New("").Parse(script)
+		require.Nil(err)
+		err = tl.Execute(&s, struct{ Target string }{u.String()})
+		require.Nil(err)
+
+		f, err := utils.GetTempFile("scriptest", s.Bytes())
+		require.Nil(err)
+		defer os.Remove(f)
+
+		g, _, err := setup(f, nil)
+		require.Nil(err)
+
+		// The tick was due a second ago
+		g.SetScheduledTime(time.Now().Add(-time.Second))
+		err = g.Tick()
+		assert.Nil(err)
+
+		err = g.Finish()
+		assert.Nil(err)
+
+		var corrected *stats.HistogramData
+		for _, r := range sts.Export().Results {
+			if r.SubTarget == "/scheduled" {
+				corrected = r.Corrected
+			}
+		}
+		require.NotNil(corrected)
+		assert.GreaterOrEqual(corrected.Max, 1000.0)
+		assert.Less(corrected.Max, 2000.0)
+	})
+
 	t.Run("API/LG/MySQL", func(t *testing.T) {
 
 		script := `
@@ -966,6 +1017,87 @@ mydata3,myval3
 		assert.Contains(sink.String(), "mydata1 myval1")
 	})
 
+	t.Run("CheckTickDataReplay", func(t *testing.T) {
+
+		data := `time,path
+	1700000000.0,/a
+	1700000000.2,/b
+	1700000000.4,/c
+	`
+		d, err := utils.GetTempFile("scriptdata*.csv", []byte(data))
+		require.Nil(err)
+		defer os.Remove(d)
+
+		script := `
+		                   function init()
+				      LG:SetTickDataFile("{{.DataFile}}")
+				      LG:SetTickDataTimestamp(1, "unix")
+				   end
+
+				   function tick(r)
+				      Log:Infof("%v", r)
+				   end
+				   `
+
+		var s bytes.Buffer
+		tl, err := template.New("").Parse(script)
+		require.Nil(err)
+		err = tl.Execute(&s, struct{ DataFile string }{d})
+		require.Nil(err)
+
+		f, err := utils.GetTempFile("scriptest", s.Bytes())
+		require.Nil(err)
+		defer os.Remove(f)
+
+		g, sink, err := setup(f, nil)
+		require.Nil(err)
+
+		assert.True(g.Paced())
+
+		// Hack
+		g.LG.replaySpeed = 2
+		g.LG.initTickData()
+		defer g.LG.finishTickData()
+
+		// Header has no timestamp
+		err = g.Tick()
+		require.NoError(err)
+
+		start := time.Now()
+		for _, path := range []string{"/a", "/b", "/c"} {
+			sink.Reset()
+			err = g.Tick()
+			require.NoError(err)
+			assert.Contains(sink.String(), path)
+		}
+		assert.InDelta(200*time.Millisecond, time.Since(start), float64(50*time.Millisecond))
+
+		// Second pass goes on from the last row
+		err = g.Tick()
+		require.NoError(err)
+		start = time.Now()
+		sink.Reset()
+		err = g.Tick()
+		require.NoError(err)
+		assert.Contains(sink.String(), "/a")
+		assert.Less(time.Since(start), 50*time.Millisecond)
+		sink.Reset()
+		err = g.Tick()
+		require.NoError(err)
+		assert.Contains(sink.String(), "/b")
+		assert.InDelta(100*time.Millisecond, time.Since(start), float64(50*time.Millisecond))
+
+		// Stopping doesn't wait for the next row, which isn't sent
+		time.AfterFunc(20*time.Millisecond, g.Stop)
+		start = time.Now()
+		sink.Reset()
+		err = g.Tick()
+		require.NoError(err)
+		assert.NotContains(sink.String(), "/c")
+		assert.Less(time.Since(start), 60*time.Millisecond)
+		assert.True(g.LG.ShouldQuit())
+	})
+
 	t.Run("CheckTickData", func(t *testing.T) {
 
 		data := `mydata1
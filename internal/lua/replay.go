@@ -0,0 +1,108 @@
+package lua
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// How late a replayed row can be handed to tick() before it is reported
+const replayMaxLag = 100 * time.Millisecond
+
+// replay paces the tick data by its timestamps, rows are due as much time
+// after the first one as between their timestamps (divided by speed). When the
+// file is read again from the start, the replay goes on from the time of its
+// last row.
+type replay struct {
+	column int
+	layout string
+	speed  float64
+
+	// Wall clock time the replay started at, timestamp of the first row of
+	// the current pass and replay time of the passes done
+	start  time.Time
+	first  time.Time
+	offset time.Duration
+	last   time.Duration
+
+	lagging int
+}
+
+// due gives the time the row is to be replayed at, now if it has no valid
+// timestamp
+func (r *replay) due(data interface{}, log *logrus.Entry) time.Time {
+	now := time.Now()
+
+	var field string
+	switch v := data.(type) {
+	case []string:
+		if r.column < len(v) {
+			field = v[r.column]
+		}
+	case string:
+		if fields := strings.Fields(v); r.column < len(fields) {
+			field = fields[r.column]
+		}
+	}
+
+	ts, err := parseTimestamp(strings.TrimSpace(field), r.layout)
+	if err != nil {
+		log.Debugf("Replay: no timestamp in %v, replaying now: %v", data, err)
+		return now
+	}
+
+	if r.start.IsZero() {
+		r.start = now
+	}
+	if r.first.IsZero() {
+		r.first = ts
+	}
+
+	// Rows out of order are replayed right after the previous one
+	d := r.offset + ts.Sub(r.first)
+	if d < r.last {
+		d = r.last
+	}
+	r.last = d
+
+	due := r.start.Add(time.Duration(float64(d) / r.speed))
+	if lag := now.Sub(due); lag > replayMaxLag {
+		if r.lagging++; r.lagging == 1 || r.lagging%100 == 1 {
+			log.Warnf("Replay is behind by %v, workers can't keep up (more --concurrency needed)", lag)
+		}
+	}
+
+	return due
+}
+
+// rewind starts a new pass over the file
+func (r *replay) rewind() {
+	r.offset = r.last
+	r.first = time.Time{}
+}
+
+func parseTimestamp(s string, layout string) (time.Time, error) {
+	switch layout {
+	case "unix", "unixms":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == "unixms" {
+			f /= 1000
+		}
+		return time.Unix(0, int64(f*float64(time.Second))), nil
+	case "":
+		layout = time.RFC3339Nano
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: %v", s, err)
+	}
+
+	return t, nil
+}
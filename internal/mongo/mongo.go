@@ -20,10 +20,15 @@ type Generator struct {
 	Database   *mongo.Database
 	Collection *mongo.Collection
 
-	log   *logrus.Entry
-	o     GeneratorOptions
-	ctx   context.Context
-	stats *stats.Stats
+	log       *logrus.Entry
+	o         GeneratorOptions
+	ctx       context.Context
+	stats     *stats.Stats
+	scheduled time.Time
+
+	// BSON bytes sent and received by the current operation
+	requestSize  int64
+	responseSize int64
 }
 
 type GeneratorOptions struct {
@@ -103,6 +108,7 @@ func (g *Generator) InitDone() error {
 func (g *Generator) Tick() error {
 	start := time.Now()
 	var err error
+	g.requestSize, g.responseSize = 0, 0
 
 	switch strings.ToLower(g.o.Operation) {
 	case "find":
@@ -125,11 +131,18 @@ func (g *Generator) Tick() error {
 	traceInfo.Key = fmt.Sprintf("%s.%s", g.o.Database, g.o.Collection)
 	traceInfo.Subkey = g.o.Operation
 	traceInfo.Total = time.Since(start)
-	
+	traceInfo.Scheduled = g.scheduled
+	if err == nil {
+		traceInfo.Sized = true
+		traceInfo.RequestSize = g.requestSize
+		traceInfo.ResponseSize = g.responseSize
+	}
+
 	if err != nil {
 		// Don't count context cancellation as a real error (happens when test ends)
 		if !errors.Is(err, context.Canceled) {
 			traceInfo.Error = true
+			traceInfo.ErrorReason = errorReason(err)
 			g.log.Errorf("MongoDB %s error: %v", g.o.Operation, err)
 		}
 	}
@@ -138,12 +151,17 @@ func (g *Generator) Tick() error {
 	return nil
 }
 
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
 func (g *Generator) performFind() error {
 	filter, err := g.parseJSON(g.o.Filter)
 	if err != nil {
 		return fmt.Errorf("invalid filter JSON: %w", err)
 	}
 
+	g.requestSize = bsonSize(filter)
 	cursor, err := g.Collection.Find(g.ctx, filter)
 	if err != nil {
 		return err
@@ -151,8 +169,7 @@ func (g *Generator) performFind() error {
 	defer cursor.Close(g.ctx)
 
 	// Consume the cursor to simulate real usage
-	var results []bson.M
-	return cursor.All(g.ctx, &results)
+	return g.consume(cursor)
 }
 
 func (g *Generator) performInsert() error {
@@ -161,6 +178,7 @@ func (g *Generator) performInsert() error {
 		return fmt.Errorf("invalid document JSON: %w", err)
 	}
 
+	g.requestSize = bsonSize(document)
 	_, err = g.Collection.InsertOne(g.ctx, document)
 	return err
 }
@@ -176,6 +194,7 @@ func (g *Generator) performUpdate() error {
 		return fmt.Errorf("invalid update JSON: %w", err)
 	}
 
+	g.requestSize = bsonSize(filter) + bsonSize(update)
 	_, err = g.Collection.UpdateMany(g.ctx, filter, update)
 	return err
 }
@@ -186,6 +205,7 @@ func (g *Generator) performDelete() error {
 		return fmt.Errorf("invalid filter JSON: %w", err)
 	}
 
+	g.requestSize = bsonSize(filter)
 	_, err = g.Collection.DeleteMany(g.ctx, filter)
 	return err
 }
@@ -218,6 +238,9 @@ func (g *Generator) performAggregate() error {
 		pipeline = []bson.M{{"$match": bson.M{}}}
 	}
 
+	for _, stage := range pipeline {
+		g.requestSize += bsonSize(stage)
+	}
 	cursor, err := g.Collection.Aggregate(g.ctx, pipeline)
 	if err != nil {
 		return err
@@ -225,8 +248,30 @@ func (g *Generator) performAggregate() error {
 	defer cursor.Close(g.ctx)
 
 	// Consume the cursor
-	var results []bson.M
-	return cursor.All(g.ctx, &results)
+	return g.consume(cursor)
+}
+
+// consume reads all the documents of the cursor, counting their bytes
+func (g *Generator) consume(cursor *mongo.Cursor) error {
+	for cursor.Next(g.ctx) {
+		g.responseSize += int64(len(cursor.Current))
+		var result bson.M
+		if err := cursor.Decode(&result); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// bsonSize gives the size of a document once encoded in BSON
+func bsonSize(doc bson.M) int64 {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return 0
+	}
+
+	return int64(len(b))
 }
 
 func (g *Generator) parseJSON(jsonStr string) (bson.M, error) {
@@ -297,4 +342,32 @@ func (g *Generator) Aggregate(pipeline string) error {
 		return nil
 	}
 	return err
-}
\ No newline at end of file
+}
+
+// errorReason gives the name (or the code) of MongoDB server errors (ex:
+// DuplicateKey), stats.ErrorReason for the others
+func errorReason(err error) string {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		if cmdErr.Name != "" {
+			return cmdErr.Name
+		}
+		return fmt.Sprintf("code %d", cmdErr.Code)
+	}
+
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		if len(writeErr.WriteErrors) > 0 {
+			return fmt.Sprintf("code %d", writeErr.WriteErrors[0].Code)
+		}
+		if writeErr.WriteConcernError != nil {
+			return writeErr.WriteConcernError.Name
+		}
+	}
+
+	if mongo.IsTimeout(err) {
+		return stats.ErrorTimeout
+	}
+
+	return stats.ErrorReason(err)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -25,10 +26,11 @@ func init() {
 type Generator struct {
 	DB *sql.DB
 
-	log   *logrus.Entry
-	o     GeneratorOptions
-	ctx   context.Context
-	stats *stats.Stats
+	log       *logrus.Entry
+	o         GeneratorOptions
+	ctx       context.Context
+	stats     *stats.Stats
+	scheduled time.Time
 }
 
 type GeneratorOptions struct {
@@ -67,7 +69,9 @@ func (g *Generator) InitDone() error {
 }
 
 func (g *Generator) Tick() error {
-	res, err := g.DB.QueryContext(g.ctx, g.o.Query)
+	// Hooks are global, pass the scheduled time along with the query
+	ctx := context.WithValue(g.ctx, scheduled, g.scheduled)
+	res, err := g.DB.QueryContext(ctx, g.o.Query)
 	if err != nil {
 		g.log.Errorf("MySQL error: %v", err)
 		return nil
@@ -76,6 +80,10 @@ func (g *Generator) Tick() error {
 	return res.Close()
 }
 
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
 func (g *Generator) Finish() error {
 	if g.DB != nil {
 		return g.DB.Close()
@@ -90,8 +98,10 @@ func (g *Generator) Open(dsn string) (*sql.DB, error) {
 
 type Hooks struct{}
 type begincontext string
+type scheduledcontext string
 
 var begin = begincontext("begin")
+var scheduled = scheduledcontext("scheduled")
 
 // Before hook will print the query with it's args and return the context with the timestamp
 func (h *Hooks) Before(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
@@ -105,6 +115,9 @@ func (h *Hooks) After(ctx context.Context, query string, args ...interface{}) (c
 	traceInfo.Key = "" // TODO: Set it host
 	traceInfo.Subkey = query
 	traceInfo.Total = time.Since(ctx.Value(begin).(time.Time))
+	if s, ok := ctx.Value(scheduled).(time.Time); ok {
+		traceInfo.Scheduled = s
+	}
 	gStats.RecordMetric(&traceInfo)
 
 	return ctx, nil
@@ -115,11 +128,27 @@ func (h *Hooks) OnError(ctx context.Context, err error, query string, args ...in
 	traceInfo.Type = stats.SqlTrace
 	traceInfo.Key = "" // TODO: Set it host
 	traceInfo.Subkey = query
+	traceInfo.Total = time.Since(ctx.Value(begin).(time.Time))
+	if s, ok := ctx.Value(scheduled).(time.Time); ok {
+		traceInfo.Scheduled = s
+	}
 
 	if !errors.Is(err, context.Canceled) {
 		traceInfo.Error = true
+		traceInfo.ErrorReason = errorReason(err)
 	}
 	gStats.RecordMetric(&traceInfo)
 
 	return err
 }
+
+// errorReason gives the number of MySQL errors (ex: error 1213),
+// stats.ErrorReason for the others
+func errorReason(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return fmt.Sprintf("error %d", mysqlErr.Number)
+	}
+
+	return stats.ErrorReason(err)
+}
@@ -3,19 +3,23 @@ package psql
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/sirupsen/logrus"
 )
 
 type begincontext string
 type querycontext string
+type scheduledcontext string
 
 var begin = begincontext("begin")
 var query = querycontext("query")
+var scheduled = scheduledcontext("scheduled")
 
 func init() {
 	sql.Register("psql", stdlib.GetDefaultDriver())
@@ -35,11 +39,14 @@ func (t tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.Trac
 	var traceInfo stats.TraceInfo
 	traceInfo.Type = stats.PGTrace
 	traceInfo.Key = conn.Config().Host
-	if data.Err == nil {
-		traceInfo.Subkey = ctx.Value(query).(string)
-		traceInfo.Total = time.Since(ctx.Value(begin).(time.Time))
-	} else {
+	traceInfo.Subkey = ctx.Value(query).(string)
+	traceInfo.Total = time.Since(ctx.Value(begin).(time.Time))
+	if s, ok := ctx.Value(scheduled).(time.Time); ok {
+		traceInfo.Scheduled = s
+	}
+	if data.Err != nil {
 		traceInfo.Error = true
+		traceInfo.ErrorReason = errorReason(data.Err)
 	}
 
 	t.stats.RecordMetric(&traceInfo)
@@ -47,11 +54,12 @@ func (t tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.Trac
 }
 
 type Generator struct {
-	DB    *sql.DB
-	log   *logrus.Entry
-	o     GeneratorOptions
-	ctx   context.Context
-	stats *stats.Stats
+	DB        *sql.DB
+	log       *logrus.Entry
+	o         GeneratorOptions
+	ctx       context.Context
+	stats     *stats.Stats
+	scheduled time.Time
 }
 
 // https://pkg.go.dev/github.com/jackc/pgconn#Config
@@ -117,7 +125,9 @@ func (g *Generator) initClient() error {
 }
 
 func (g *Generator) Tick() error {
-	res, err := g.DB.QueryContext(g.ctx, g.o.Query)
+	// Tracer is per connection, pass the scheduled time along with the query
+	ctx := context.WithValue(g.ctx, scheduled, g.scheduled)
+	res, err := g.DB.QueryContext(ctx, g.o.Query)
 	if err != nil {
 		g.log.Errorf("PG error: %v", err)
 	}
@@ -127,6 +137,10 @@ func (g *Generator) Tick() error {
 	return nil
 }
 
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
 func (g *Generator) Finish() error {
 	if g.DB != nil {
 		return g.DB.Close()
@@ -134,3 +148,14 @@ func (g *Generator) Finish() error {
 
 	return nil
 }
+
+// errorReason gives the SQLSTATE of PostgreSQL errors (ex: SQLSTATE 40001),
+// stats.ErrorReason for the others
+func errorReason(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return "SQLSTATE " + pgErr.Code
+	}
+
+	return stats.ErrorReason(err)
+}
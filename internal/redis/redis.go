@@ -2,7 +2,9 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/freshworks/load-generator/internal/stats"
@@ -13,11 +15,12 @@ import (
 type Generator struct {
 	log *logrus.Entry
 
-	Client *redis.Client
-	cmd    *redis.StringCmd
-	o      GeneratorOptions
-	stats  *stats.Stats
-	ctx    context.Context
+	Client    *redis.Client
+	cmd       *redis.StringCmd
+	o         GeneratorOptions
+	stats     *stats.Stats
+	ctx       context.Context
+	scheduled time.Time
 }
 
 type GeneratorOptions struct {
@@ -89,6 +92,10 @@ func (r *Generator) Finish() error {
 	return nil
 }
 
+func (r *Generator) SetScheduledTime(t time.Time) {
+	r.scheduled = t
+}
+
 func (r *Generator) Open() *redis.Client {
 	cl := redis.NewClient(&redis.Options{
 		Addr:     r.o.Target,
@@ -121,12 +128,14 @@ func (rh *redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
 	traceInfo.Type = stats.RedisTrace
 	traceInfo.Key = rh.gn.o.Target
 	traceInfo.Subkey = cmd.Name()
+	traceInfo.Scheduled = rh.gn.scheduled
 
 	err := cmd.Err()
 	traceInfo.Total = time.Since(ctx.Value(begin).(time.Time))
 
 	if err != nil && err != redis.Nil {
 		traceInfo.Error = true
+		traceInfo.ErrorReason = errorReason(err)
 	}
 
 	rh.gn.stats.RecordMetric(&traceInfo)
@@ -148,6 +157,7 @@ func (rh *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmde
 	for _, cmd := range cmds {
 		if err = cmd.Err(); err != nil {
 			traceInfo.Error = true
+			traceInfo.ErrorReason = errorReason(err)
 			break
 		}
 	}
@@ -157,3 +167,20 @@ func (rh *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmde
 	rh.gn.stats.RecordMetric(&traceInfo)
 	return err
 }
+
+// errorReason gives the prefix of Redis errors (ex: WRONGTYPE, MOVED),
+// stats.ErrorReason for the others
+func errorReason(err error) string {
+	if err == redis.Nil {
+		return "nil"
+	}
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		if prefix := strings.Fields(redisErr.Error()); len(prefix) > 0 {
+			return prefix[0]
+		}
+	}
+
+	return stats.ErrorReason(err)
+}
@@ -63,6 +63,23 @@ func TestRedis(t *testing.T) {
 		assert.Nil(err)
 	})
 
+	t.Run("ErrorReason", func(t *testing.T) {
+		svr.Set("str", "value")
+		o := *options
+		o.Cmd = "lpush"
+		o.Args = []string{"str", "value"}
+		g := NewGenerator(0, o, context.Background(), 1, sts)
+		require.NotNil(g)
+		sts.Reset()
+
+		require.NoError(g.Init())
+		require.NoError(g.Tick())
+		r := getStatResultFor(sts, options.Target, o.Cmd)
+		require.NotNil(r)
+		assert.Equal(1, *r.Errors)
+		assert.Equal([]stats.ErrorCount{{Reason: "WRONGTYPE", Count: 1}}, r.ErrorReasons)
+		assert.Nil(g.Finish())
+	})
 }
 
 func getStatResultFor(s *stats.Stats, key string, subkey string) *stats.Result {
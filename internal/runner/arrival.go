@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Distribution gives the gaps between consecutive events (ex: request
+// arrivals) in units of the mean gap, ie the values it returns average to 1.
+// It is scaled by the current request rate, so the rate (and stages) still
+// decide the average throughput and the distribution only decides its shape.
+type Distribution interface {
+	Next() float64
+	String() string
+}
+
+// Random numbers of the distributions, the tests use a seeded source instead
+// for them to be deterministic
+var (
+	randExpFloat64 = rand.ExpFloat64
+	randFloat64    = rand.Float64
+	randIntn       = rand.Intn
+)
+
+type constantDistribution struct{}
+
+func (constantDistribution) Next() float64  { return 1 }
+func (constantDistribution) String() string { return "constant" }
+
+// poissonDistribution gives exponentially distributed gaps (ie a Poisson
+// process), which is how independent users tend to arrive
+type poissonDistribution struct{}
+
+func (poissonDistribution) Next() float64  { return randExpFloat64() }
+func (poissonDistribution) String() string { return "poisson" }
+
+// uniformDistribution spreads the gaps uniformly within +/- jitter of the
+// mean gap
+type uniformDistribution struct {
+	jitter float64
+}
+
+func (u uniformDistribution) Next() float64 {
+	return 1 + u.jitter*(2*randFloat64()-1)
+}
+
+func (u uniformDistribution) String() string {
+	return fmt.Sprintf("uniform:%v", u.jitter)
+}
+
+// empiricalDistribution samples the gaps from the given ones, normalized by
+// their mean
+type empiricalDistribution struct {
+	file string
+	gaps []float64
+}
+
+func (e empiricalDistribution) Next() float64 {
+	return e.gaps[randIntn(len(e.gaps))]
+}
+
+func (e empiricalDistribution) String() string {
+	return "empirical:" + e.file
+}
+
+// ParseDistribution parses a distribution:
+//
+//	constant            evenly spaced
+//	poisson             exponential gaps
+//	uniform[:<jitter>]  uniform gaps within +/- jitter (0-1, fraction of the
+//	                    mean gap, default 1)
+//	empirical:<file>    gaps sampled from the file, one per line as a
+//	                    duration (ex: 12ms) or a number of milliseconds
+func ParseDistribution(s string) (Distribution, error) {
+	name, arg, _ := strings.Cut(s, ":")
+	switch name {
+	case "", "constant":
+		return constantDistribution{}, nil
+	case "poisson":
+		return poissonDistribution{}, nil
+	case "uniform":
+		jitter := 1.0
+		if arg != "" {
+			var err error
+			jitter, err = strconv.ParseFloat(arg, 64)
+			if err != nil || jitter < 0 || jitter > 1 {
+				return nil, fmt.Errorf("invalid uniform jitter %q, should be between 0 and 1", arg)
+			}
+		}
+		return uniformDistribution{jitter: jitter}, nil
+	case "empirical":
+		if arg == "" {
+			return nil, fmt.Errorf("empirical distribution needs a file, ex: empirical:gaps.txt")
+		}
+		return loadEmpirical(arg)
+	}
+
+	return nil, fmt.Errorf("unknown distribution %q, should be one of constant, poisson, uniform[:<jitter>] or empirical:<file>", s)
+}
+
+func loadEmpirical(file string) (Distribution, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	e := empiricalDistribution{file: file}
+	total := 0.0
+	for i, line := range strings.Split(string(b), "\n") {
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			d, derr := time.ParseDuration(line)
+			if derr != nil {
+				return nil, fmt.Errorf("%s:%d: invalid gap %q", file, i+1, line)
+			}
+			v = float64(d) / float64(time.Millisecond)
+		}
+
+		if v < 0 {
+			return nil, fmt.Errorf("%s:%d: negative gap %q", file, i+1, line)
+		}
+
+		e.gaps = append(e.gaps, v)
+		total += v
+	}
+
+	if total == 0 {
+		return nil, fmt.Errorf("%s: no (non zero) gaps found", file)
+	}
+
+	mean := total / float64(len(e.gaps))
+	for i := range e.gaps {
+		e.gaps[i] /= mean
+	}
+
+	return e, nil
+}
@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+type controlStatus struct {
+	RequestRate float64
+	Workers     int
+	Paused      bool
+}
+
+// serveControl serves the control API on addr, until the returned function
+// is called
+func (r *Runner) serveControl(addr string) func() {
+	h := &http.Server{Addr: addr, Handler: r.controlHandler()}
+	go func() {
+		log.Infof("Control API on http://%s", addr)
+		if err := h.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Warnf("Control API: %v", err)
+		}
+	}()
+
+	return func() {
+		h.Shutdown(context.Background())
+	}
+}
+
+// controlHandler serves the control API:
+//
+//	GET  /status                current rate, workers and whether paused
+//	POST /rate?value=<rps>      change the request rate (not with --stages)
+//	POST /workers?value=<n>     add or retire workers (not with --max-workers)
+//	POST /pause, POST /resume   stop and restart ticking
+//	POST /reset                 reset the metrics collected so far
+func (r *Runner) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", r.controlStatus)
+	mux.HandleFunc("POST /rate", r.controlRate)
+	mux.HandleFunc("POST /workers", r.controlWorkers)
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, req *http.Request) {
+		r.pause()
+		r.controlStatus(w, req)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, req *http.Request) {
+		r.resume()
+		r.controlStatus(w, req)
+	})
+	mux.HandleFunc("POST /reset", func(w http.ResponseWriter, req *http.Request) {
+		log.Infof("Control: resetting metrics")
+		r.stats.ResetMetrics()
+		r.controlStatus(w, req)
+	})
+
+	return mux
+}
+
+func (r *Runner) controlStatus(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(controlStatus{
+		RequestRate: float64(r.limiter.Limit()),
+		Workers:     r.numWorkers(),
+		Paused:      r.paused(),
+	})
+}
+
+func controlValue(req *http.Request) (int, error) {
+	v, err := strconv.Atoi(req.URL.Query().Get("value"))
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid value %q, expected a non-negative integer", req.URL.Query().Get("value"))
+	}
+
+	return v, nil
+}
+
+func (r *Runner) controlRate(w http.ResponseWriter, req *http.Request) {
+	v, err := controlValue(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.closedLoop() {
+		http.Error(w, "request rate isn't controlled in this run (--requestrate 0 or --users)", http.StatusConflict)
+		return
+	}
+	if len(r.stages) > 0 {
+		// The stages would set it back right away
+		http.Error(w, "request rate is set by --stages in this run", http.StatusConflict)
+		return
+	}
+
+	log.Infof("Control: changing request rate to %d", v)
+	r.limiter.SetLimit(rate.Limit(v))
+	r.controlStatus(w, req)
+}
+
+func (r *Runner) controlWorkers(w http.ResponseWriter, req *http.Request) {
+	v, err := controlValue(req)
+	if err != nil || v == 0 {
+		http.Error(w, "invalid value, expected number of workers (>0)", http.StatusBadRequest)
+		return
+	}
+
+	if r.maxWorkers > 0 {
+		// The elastic pool would scale it back
+		http.Error(w, "workers are scaled by --max-workers in this run", http.StatusConflict)
+		return
+	}
+
+	log.Infof("Control: changing workers to %d", v)
+	r.setWorkers(v, "")
+	r.controlStatus(w, req)
+}
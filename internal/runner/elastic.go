@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"math"
+	"time"
+
+	"github.com/freshworks/load-generator/internal/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// How often the elastic worker pool is resized, and how often the
+	// workers are sampled in between
+	scaleInterval       = time.Second
+	scaleSampleInterval = 100 * time.Millisecond
+)
+
+// scaler resizes the worker pool between minWorkers and maxWorkers. When
+// ticks had to wait for a free worker or the waiting ones piled up during the
+// last interval, workers are added to keep up with the ticks (and drain the
+// waiting ones) at the rate the current workers got through them. Workers are
+// retired (by a quarter) when none were waiting and at most half of them were
+// ever busy at once. The interval after a change is skipped, to let new
+// workers start and retired ones finish.
+func (r *Runner) scaler() {
+	t := time.NewTicker(scaleSampleInterval)
+	defer t.Stop()
+
+	samples, waiting, busy := 0, 0, 0
+	settling := false
+	last := r.tickCounts()
+	for {
+		select {
+		case <-t.C:
+		case <-r.tickCtx.Done():
+			return
+		}
+
+		if r.paused() {
+			// Idle workers while paused say nothing about the load
+			samples, waiting, busy = 0, 0, 0
+			last = r.tickCounts()
+			continue
+		}
+
+		samples++
+		if r.waiting() > 0 {
+			waiting++
+		}
+		busy = max(busy, r.busyWorkers())
+
+		if time.Duration(samples)*scaleSampleInterval < scaleInterval {
+			continue
+		}
+
+		if r.tickCtx.Err() != nil {
+			return
+		}
+
+		if settling {
+			settling = false
+			samples, waiting, busy = 0, 0, 0
+			last = r.tickCounts()
+			continue
+		}
+
+		n := r.numWorkers()
+		c := r.tickCounts()
+		behind := (c.late - last.late) + (c.missed - last.missed)
+		switch {
+		case (behind > 0 || c.waiting() > last.waiting()) && n < r.maxWorkers:
+			target := n + 1
+			// Ticks scheduled, and picked up by the workers
+			ticks := (c.sent - last.sent) + int64(c.backlog-last.backlog) + (c.missed - last.missed)
+			if done := (c.sent - last.sent) - int64(c.queued-last.queued); done > 0 {
+				need := float64(n) * float64(ticks+int64(c.waiting())) / float64(done)
+				target = max(int(math.Ceil(need)), target)
+			}
+			target = min(target, r.maxWorkers)
+			log.Infof("Falling behind the request rate (%d late, %d waiting), adding workers: %d -> %d", behind, c.waiting(), n, target)
+			r.setWorkers(target, stats.WorkersScaledUp)
+			settling = true
+		case behind == 0 && waiting == 0 && busy <= n/2 && n > r.minWorkers:
+			target := max(n-int(math.Ceil(float64(n)/4)), r.minWorkers)
+			log.Infof("Workers idle (at most %d busy), retiring workers: %d -> %d", busy, n, target)
+			r.setWorkers(target, stats.WorkersScaledDown)
+			settling = true
+		}
+
+		samples, waiting, busy = 0, 0, 0
+		last = c
+	}
+}
+
+// tickCounts is a snapshot of the tick counters of a runner
+type tickCounts struct {
+	sent   int64
+	late   int64
+	missed int64
+	// Ticks in the work channel, and in the backlog
+	queued  int
+	backlog int
+}
+
+func (r *Runner) tickCounts() tickCounts {
+	return tickCounts{
+		sent:    r.sent.Load(),
+		late:    r.late.Load(),
+		missed:  r.missed.Load(),
+		queued:  len(r.workChan),
+		backlog: r.backlogLen(),
+	}
+}
+
+// waiting is the number of ticks not picked up by a worker yet
+func (c tickCounts) waiting() int {
+	return c.queued + c.backlog
+}
+
+// busyWorkers is the number of workers running a tick
+func (r *Runner) busyWorkers() int {
+	r.workersMux.Lock()
+	defer r.workersMux.Unlock()
+
+	n := 0
+	for _, lg := range r.workers {
+		if lg.Busy() {
+			n++
+		}
+	}
+
+	return n
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/freshworks/load-generator/internal/loadgen"
@@ -18,135 +19,1015 @@ type Runner struct {
 	concurrency  int
 	warmup       time.Duration
 	duration     time.Duration
+	stages       []Stage
+	arrival      Distribution
+	thinkTime    time.Duration
+	thinkDist    Distribution
+	iterations   int
+	perWorker    int
+	controlAddr  string
 	newGenerator loadgen.NewGenerator
 	ctx          context.Context
 	cancel       context.CancelFunc
+	tickCtx      context.Context
+	tickCancel   context.CancelFunc
+	stopTimeout  time.Duration
+	stopOnce     sync.Once
+	abandonOnce  sync.Once
 	workChan     chan interface{}
+	limiter      *rate.Limiter
 	stats        *stats.Stats
+
+	// Closed while paused, nil otherwise
+	pauseMux sync.Mutex
+	resumed  chan struct{}
+
+	workersMux sync.Mutex
+	workers    []*loadgen.LoadGenerator
+	lastId     int
+	started    chan struct{}
+	runDoneWg  sync.WaitGroup
+
+	// Ticks handed to workers, ticks which had to wait for a free worker and
+	// ticks dropped as too many were waiting
+	sent   atomic.Int64
+	late   atomic.Int64
+	missed atomic.Int64
+
+	// Ticks waiting for a free worker, oldest first, and a signal that some
+	// were added
+	backlogMux sync.Mutex
+	backlog    []time.Time
+	backlogged chan struct{}
+
+	// Remaining ticks of the iteration budget, and how the workers did
+	// (protected by workersMux)
+	budget       atomic.Int64
+	ticksDone    int
+	workersShort int
+	tickErr      error
+
+	// Worker failure policies, workers which failed initialization
+	// (protected by workersMux) and workers running ticks, of all the
+	// runners sharing the stats (see RunAll)
+	maxInitFailures float64
+	restart         bool
+	restartBackoff  time.Duration
+	initFailures    int
+	live            *atomic.Int32
+
+	// Elastic worker pool bounds (MaxWorkers 0 when disabled), and the event
+	// to record when retired workers quit (protected by workersMux)
+	minWorkers int
+	maxWorkers int
+	retired    map[*loadgen.LoadGenerator]string
+
+	startAt      time.Time
+	startBarrier func(ctx context.Context) (time.Time, error)
+
+	// Set once stopping, and if stopped by Interrupt
+	stopping    atomic.Bool
+	interrupted atomic.Bool
+}
+
+type Options struct {
+	RequestRate int
+	Concurrency int
+	Warmup      time.Duration
+	Duration    time.Duration
+	// Staged load profile, overrides RequestRate and Duration
+	Stages []Stage
+	// Distribution of the gaps between requests, evenly spaced if nil
+	Arrival Distribution
+	// Closed loop mode: number of virtual users, each running ticks one
+	// after the other with ThinkTime (shaped by ThinkDist) in between.
+	// Overrides RequestRate and Concurrency.
+	Users     int
+	ThinkTime time.Duration
+	ThinkDist Distribution
+	// Stop after this many ticks in total, or per worker (0 for no limit).
+	// The run still stops on Duration, if set.
+	Iterations          int
+	IterationsPerWorker int
+	// Address to serve the control API on, to change the rate and workers,
+	// pause/resume or reset metrics during the run
+	ControlAddr string
+	// How long in-flight ticks are given to finish once the run is stopped,
+	// before they are cancelled
+	StopTimeout time.Duration
+	// Abort the run if more than this percentage of the workers fail to
+	// initialize (100 to run with whichever workers are left)
+	MaxInitFailures float64
+	// Finish and initialize again workers whose tick failed, waiting
+	// RestartBackoff (doubled on each failed attempt) in between
+	RestartWorkers bool
+	RestartBackoff time.Duration
+	// Elastic worker pool: start with MinWorkers and add workers, up to
+	// MaxWorkers, while the request rate is missed, retiring idle ones.
+	// Disabled (Concurrency workers) if MaxWorkers is 0.
+	MinWorkers int
+	MaxWorkers int
+	// Once the workers are initialized, wait until StartAt to start ticking
+	// (and warming up), or until the time given by StartBarrier, if set. Used
+	// to start runs on several hosts together.
+	StartAt      time.Time
+	StartBarrier func(ctx context.Context) (time.Time, error)
 }
 
-func New(requestrate, concurrency int, warmup, duration time.Duration, ctx context.Context, s *stats.Stats, newGenerator loadgen.NewGenerator) *Runner {
+func NewOptions() *Options {
+	return &Options{
+		RequestRate:     1,
+		Concurrency:     1,
+		StopTimeout:     10 * time.Second,
+		MaxInitFailures: 100,
+		RestartBackoff:  time.Second,
+	}
+}
+
+func New(o Options, ctx context.Context, s *stats.Stats, newGenerator loadgen.NewGenerator) *Runner {
 	rctx, rcan := context.WithCancel(ctx)
-	return &Runner{
-		requestrate:  requestrate,
-		concurrency:  concurrency,
-		warmup:       warmup,
-		duration:     duration,
+	tctx, tcan := context.WithCancel(rctx)
+	r := &Runner{
+		requestrate:  o.RequestRate,
+		concurrency:  o.Concurrency,
+		warmup:       o.Warmup,
+		duration:     o.Duration,
+		stages:       o.Stages,
+		arrival:      o.Arrival,
+		iterations:   o.Iterations,
+		perWorker:    o.IterationsPerWorker,
+		controlAddr:  o.ControlAddr,
 		newGenerator: newGenerator,
 		ctx:          rctx,
 		cancel:       rcan,
+		tickCtx:      tctx,
+		tickCancel:   tcan,
+		live:         new(atomic.Int32),
+		stopTimeout:  o.StopTimeout,
 		stats:        s,
+
+		maxInitFailures: o.MaxInitFailures,
+		restart:         o.RestartWorkers,
+		restartBackoff:  o.RestartBackoff,
+		startAt:         o.StartAt,
+		startBarrier:    o.StartBarrier,
+	}
+
+	if o.MaxWorkers > 0 && o.RequestRate > 0 && o.Users == 0 && len(o.Stages) == 0 {
+		r.minWorkers = max(o.MinWorkers, 1)
+		r.maxWorkers = max(o.MaxWorkers, r.minWorkers)
+		// Generators size themselves (ex: connection pools) for the most
+		// workers there can be
+		r.concurrency = r.maxWorkers
+	}
+
+	if o.Users > 0 {
+		r.requestrate = 0
+		r.concurrency = o.Users
+		r.thinkTime = o.ThinkTime
+		r.thinkDist = o.ThinkDist
+		if r.thinkDist == nil {
+			r.thinkDist = constantDistribution{}
+		}
+		r.newGenerator = r.newUserGenerator(newGenerator)
 	}
-}
 
-func (r *Runner) Run() {
-	r.workChan = make(chan interface{}, r.requestrate+2)
+	return r
+}
 
-	var initDoneWg, runDoneWg sync.WaitGroup
+func (r *Runner) Run() error {
+	if err := r.run(); err != nil {
+		return err
+	}
 
-	initDoneWg.Add(r.concurrency)
-	runDoneWg.Add(r.concurrency)
+	// Print stats
+	log.Debug("Printing statistics")
+	fmt.Print(r.stats.Report())
 
-	log.Debugf("Starting %d workers", r.concurrency)
-	for i := 0; i < r.concurrency; i++ {
-		lg := loadgen.NewLoadGenerator(i+1, r.requestrate, r.concurrency, r.newGenerator, r.workChan, r.ctx, r.stats)
+	return nil
+}
 
-		go func() {
-			defer func() {
-				lg.Finish()
-				runDoneWg.Done()
+// RunAll runs the runners together and prints the report of the stats they
+// share once all of them are done. The workers of all the runners are
+// initialized before any of them starts, metrics are reset once they all did
+// and the warmup (of the first runner's options, which all share) is done
+// once for all of them. The live workers and iteration budgets recorded are
+// the ones of all the runners.
+func RunAll(runners []*Runner, s *stats.Stats) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(runners))
+	all := func(f func(r *Runner) error) error {
+		for i, r := range runners {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = f(r)
 			}()
-			err := lg.Init()
-			initDoneWg.Done()
-			if err != nil {
-				log.Errorf("Initialization failed: %v", err)
-				return
-			}
+		}
+		wg.Wait()
 
-			// Wait for all goroutines to finish initialization
-			initDoneWg.Wait()
+		return errors.Join(errs...)
+	}
 
-			lg.Run()
-		}()
+	// One count of live workers for the stats
+	for _, r := range runners[1:] {
+		r.live = runners[0].live
 	}
 
+	err := all((*Runner).init)
+	if err == nil {
+		err = runners[0].waitStart()
+	}
+	if err != nil {
+		log.Error(err)
+		for _, r := range runners {
+			r.stopWorkers()
+		}
+		return err
+	}
+
+	s.ResetMetrics()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go warmupTimer(ctx, runners[0].warmup, s)
+
+	if err := all((*Runner).start); err != nil {
+		return err
+	}
+
+	// Print stats
+	log.Debug("Printing statistics")
+	fmt.Print(s.Report())
+
+	return nil
+}
+
+func (r *Runner) run() error {
+	err := r.init()
+	if err == nil {
+		err = r.waitStart()
+	}
+	if err != nil {
+		log.Error(err)
+		r.stopWorkers()
+		return err
+	}
+
+	r.stats.ResetMetrics()
+
+	// Start the warmup
+	log.Debug("Starting warmup")
+	go warmupTimer(r.tickCtx, r.warmup, r.stats)
+
+	return r.start()
+}
+
+// init starts the workers and waits for them to be initialized
+func (r *Runner) init() error {
+	initialRate := r.requestrate
+	maxRate := r.requestrate
+	if len(r.stages) > 0 {
+		initialRate = 0
+		maxRate = maxStageRate(r.stages)
+	}
+
+	r.workChan = make(chan interface{}, maxRate+2)
+	r.limiter = rate.NewLimiter(rate.Limit(initialRate), 2)
+	r.started = make(chan struct{})
+	r.backlogged = make(chan struct{}, 1)
+	r.budget.Store(int64(r.iterations))
+
+	var initDoneWg sync.WaitGroup
+
+	n := r.initialWorkers()
+	log.Debugf("Starting %d workers", n)
+	r.addWorkers(n, &initDoneWg, "")
+
 	// Wait for the initialization to be done
 	initDoneWg.Wait()
+	if err := r.checkInitFailures(n); err != nil {
+		return err
+	}
 
-	log.Infof("Starting ...")
+	if !r.closedLoop() && r.paced() {
+		if len(r.stages) > 0 || r.maxWorkers > 0 {
+			return fmt.Errorf("requests are paced by the generator (ex: tick data replay), --stages and --max-workers can't be used")
+		}
+		log.Infof("Requests are paced by the generator (ex: tick data replay), not by --requestrate")
+		r.requestrate = 0
+	}
 
-	r.stats.ResetMetrics()
+	return nil
+}
+
+// paced tells whether the generators pace the ticks themselves
+func (r *Runner) paced() bool {
+	r.workersMux.Lock()
+	defer r.workersMux.Unlock()
+
+	return len(r.workers) > 0 && r.workers[0].Paced()
+}
+
+// stopWorkers stops the workers of a run which didn't start
+func (r *Runner) stopWorkers() {
+	r.cancel()
+	r.runDoneWg.Wait()
+}
+
+// start makes the initialized workers generate load, until the run is done
+func (r *Runner) start() error {
+	close(r.started)
+
+	runningMux.Lock()
+	running[r] = struct{}{}
+	runningMux.Unlock()
+	defer func() {
+		runningMux.Lock()
+		delete(running, r)
+		runningMux.Unlock()
+	}()
+
+	if r.controlAddr != "" {
+		stopControl := r.serveControl(r.controlAddr)
+		defer stopControl()
+	}
+
+	stopSignals := r.handleSignals()
+	defer stopSignals()
+
+	log.Infof("Starting ...")
 
 	// Ticker to generate work at constant throughput
 	log.Debug("Starting work ticker")
 	go r.ticker()
+	go r.dispatcher()
 
-	// Start the warmup
-	log.Debug("Starting warmup")
-	go r.warmupTimer()
+	if len(r.stages) > 0 {
+		// Stages decide the rate and when to stop
+		log.Debug("Starting stages")
+		go r.stager()
+	} else {
+		// Timer to stop after specified duration
+		log.Debug("Starting duration timer")
+		go r.durationTimer()
+	}
 
-	// Timer to stop after specified duration
-	log.Debug("Starting duration timer")
-	go r.durationTimer()
+	if r.maxWorkers > 0 {
+		log.Debug("Starting worker scaler")
+		go r.scaler()
+	}
 
 	// Wait for all workers to quit
 	log.Debug("Waiting for workers to finish")
-	runDoneWg.Wait()
+	r.runDoneWg.Wait()
 
-	// Print stats
-	log.Debug("Printing statistics")
-	fmt.Print(r.stats.Report())
+	// Workers might have quit on their own (ex: iteration budget)
+	r.cancel()
+
+	if n := r.backlogLen(); n > 0 {
+		log.Warnf("%d requests still waiting for a free worker at stop were not sent", n)
+	}
+
+	if r.iterations > 0 || r.perWorker > 0 {
+		r.recordBudget()
+	}
+
+	return nil
+}
+
+// waitStart waits until the scheduled start time, the one given by the start
+// barrier if any
+func (r *Runner) waitStart() error {
+	at := r.startAt
+	if r.startBarrier != nil {
+		log.Infof("Workers ready, waiting at the start barrier")
+		var err error
+		if at, err = r.startBarrier(r.ctx); err != nil {
+			return fmt.Errorf("start barrier: %v", err)
+		}
+	}
+
+	if at.IsZero() {
+		return nil
+	}
+
+	d := time.Until(at)
+	if d <= 0 {
+		log.Warnf("Start time (%v) has already passed, starting now", at.Format(time.RFC3339Nano))
+		return nil
+	}
+
+	log.Infof("Workers ready, starting at %v (in %v)", at.Format(time.RFC3339Nano), d.Round(time.Millisecond))
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-r.ctx.Done():
+		return fmt.Errorf("interrupted while waiting to start: %v", r.ctx.Err())
+	}
+}
+
+// checkInitFailures tells whether too many of the n workers failed to
+// initialize to go on with the run
+func (r *Runner) checkInitFailures(n int) error {
+	r.workersMux.Lock()
+	failed := r.initFailures
+	r.workersMux.Unlock()
+
+	if n == 0 || failed == 0 {
+		return nil
+	}
+
+	percent := 100 * float64(failed) / float64(n)
+	if percent > r.maxInitFailures {
+		return fmt.Errorf("%d of %d workers (%.1f%%) failed to initialize, more than the %.1f%% allowed", failed, n, percent, r.maxInitFailures)
+	}
+
+	log.Warnf("%d of %d workers failed to initialize, running with the rest", failed, n)
+	return nil
 }
 
+// Stop stops the run gracefully: no new ticks are started and the ticks in
+// flight are given StopTimeout to finish, after which they are cancelled (and
+// reported as abandoned)
 func (r *Runner) Stop() {
-	r.cancel()
+	r.stopOnce.Do(func() {
+		r.stopping.Store(true)
+		r.tickCancel()
+
+		r.workersMux.Lock()
+		n := len(r.workers)
+		for _, lg := range r.workers {
+			lg.Stop()
+		}
+		r.workersMux.Unlock()
+
+		if n > 0 {
+			log.Infof("Stopping, waiting up to %v for in-flight requests", r.stopTimeout)
+		}
+
+		go func() {
+			t := time.NewTimer(r.stopTimeout)
+			defer t.Stop()
+
+			select {
+			case <-t.C:
+				r.abandon(fmt.Sprintf("Stop timeout (%v)", r.stopTimeout))
+			case <-r.ctx.Done():
+			}
+		}()
+	})
+}
+
+// abandon cancels the ticks in flight, counting them as abandoned
+func (r *Runner) abandon(reason string) {
+	r.abandonOnce.Do(func() {
+		n := r.busyWorkers()
+		if n > 0 {
+			log.Warnf("%s: abandoning %d in-flight requests", reason, n)
+			r.stats.RecordAbandoned(n)
+		}
+
+		r.cancel()
+	})
+}
+
+// Runs in progress, stopped by Interrupt
+var (
+	runningMux sync.Mutex
+	running    = map[*Runner]struct{}{}
+)
+
+// Interrupt stops the runs in progress: gracefully the first time (see Stop)
+// and right away the next time, abandoning the ticks in flight. It returns
+// false if no run was stopped gracefully (none in progress, or already
+// stopping), for the caller to stop on its own.
+func Interrupt() bool {
+	runningMux.Lock()
+	defer runningMux.Unlock()
+
+	graceful := false
+	for r := range running {
+		if r.stopping.Load() {
+			r.abandon("Interrupted")
+			continue
+		}
+
+		log.Infof("Interrupted, stopping (interrupt again to stop right away)")
+		r.interrupted.Store(true)
+		r.Stop()
+		graceful = true
+	}
+
+	return graceful
+}
+
+func (r *Runner) initialWorkers() int {
+	if len(r.stages) > 0 {
+		return 1
+	}
+
+	if r.maxWorkers > 0 {
+		return r.minWorkers
+	}
+
+	return r.concurrency
+}
+
+// addWorkers starts n new workers. Workers start generating load once
+// r.started is closed, initDoneWg is marked done once they are initialized.
+// event is recorded when they start, stats.WorkersStarted if empty.
+func (r *Runner) addWorkers(n int, initDoneWg *sync.WaitGroup, event string) {
+	r.workersMux.Lock()
+	defer r.workersMux.Unlock()
+
+	for i := 0; i < n; i++ {
+		r.lastId++
+		lg := loadgen.NewLoadGenerator(r.lastId, r.requestrate, r.concurrency, r.newGenerator, r.workChan, r.ctx, r.stats)
+		if r.iterations > 0 {
+			lg.SetBudget(&r.budget)
+		}
+		lg.SetIterations(r.perWorker)
+		r.workers = append(r.workers, lg)
+
+		initDoneWg.Add(1)
+		r.runDoneWg.Add(1)
+		go r.runWorker(lg, initDoneWg, event)
+	}
+}
+
+// maxRestartBackoff caps the backoff between restarts of a worker
+const maxRestartBackoff = time.Minute
+
+// runWorker initializes the worker and runs it once the run is started. If
+// restarts are enabled, a worker whose tick failed is finished and
+// initialized again, with an exponential backoff between attempts.
+func (r *Runner) runWorker(lg *loadgen.LoadGenerator, initDoneWg *sync.WaitGroup, event string) {
+	finished := false
+	defer func() {
+		if !finished {
+			lg.Finish()
+		}
+		r.removeWorker(lg)
+		r.runDoneWg.Done()
+	}()
+
+	err := lg.Init()
+	initDoneWg.Done()
+	if err != nil {
+		log.Errorf("Initialization failed: %v", err)
+		r.workersMux.Lock()
+		r.initFailures++
+		r.workersMux.Unlock()
+		r.recordWorkers(0, stats.WorkersInitFailed)
+		return
+	}
+
+	// Wait for all goroutines to finish initialization
+	select {
+	case <-r.started:
+	case <-r.ctx.Done():
+		return
+	}
+
+	backoff := r.restartBackoff
+	if event == "" {
+		event = stats.WorkersStarted
+	}
+	for {
+		r.recordWorkers(1, event)
+		ticks := lg.Ticks()
+		lg.Run()
+		if lg.Err() == nil || !r.restart || r.tickCtx.Err() != nil {
+			r.recordWorkers(-1, r.retiredEvent(lg))
+			return
+		}
+		r.recordWorkers(-1, stats.WorkersTickFailed)
+
+		lg.Finish()
+		finished = true
+		for {
+			log.Infof("Restarting worker in %v", backoff)
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-r.tickCtx.Done():
+				t.Stop()
+				return
+			}
+
+			backoff *= 2
+			if backoff > maxRestartBackoff {
+				backoff = maxRestartBackoff
+			}
+
+			if err := lg.Init(); err != nil {
+				log.Errorf("Initialization failed: %v", err)
+				continue
+			}
+			finished = false
+			break
+		}
+
+		if lg.Ticks()-ticks > 1 {
+			// It was doing fine for a while
+			backoff = r.restartBackoff
+		}
+		event = stats.WorkersRestarted
+	}
+}
+
+// recordWorkers records a change of delta in the number of live workers
+func (r *Runner) recordWorkers(delta int32, event string) {
+	r.stats.RecordWorkers(int(r.live.Add(delta)), event)
+}
+
+func (r *Runner) removeWorker(lg *loadgen.LoadGenerator) {
+	r.workersMux.Lock()
+	defer r.workersMux.Unlock()
+
+	r.ticksDone += lg.Ticks()
+	if lg.Ticks() < r.perWorker {
+		r.workersShort++
+	}
+	if r.tickErr == nil {
+		r.tickErr = lg.Err()
+	}
+
+	for i, w := range r.workers {
+		if w == lg {
+			r.workers = append(r.workers[:i], r.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+// setWorkers adds or retires workers to have n workers running. Retired
+// workers finish their current tick before quitting. event is recorded as
+// workers start or quit, stats.WorkersStarted or stats.WorkersDone if empty.
+func (r *Runner) setWorkers(n int, event string) {
+	r.workersMux.Lock()
+	current := len(r.workers)
+	if n < current {
+		for _, lg := range r.workers[n:] {
+			if event != "" {
+				if r.retired == nil {
+					r.retired = map[*loadgen.LoadGenerator]string{}
+				}
+				r.retired[lg] = event
+			}
+			lg.Stop()
+		}
+		r.workers = r.workers[:n]
+	}
+	r.workersMux.Unlock()
+
+	if n > current {
+		var initDoneWg sync.WaitGroup
+		r.addWorkers(n-current, &initDoneWg, event)
+	}
+}
+
+// retiredEvent is the event to record when the worker quits
+func (r *Runner) retiredEvent(lg *loadgen.LoadGenerator) string {
+	r.workersMux.Lock()
+	defer r.workersMux.Unlock()
+
+	if event, ok := r.retired[lg]; ok {
+		delete(r.retired, lg)
+		return event
+	}
+
+	return stats.WorkersDone
+}
+
+func (r *Runner) recordBudget() {
+	r.workersMux.Lock()
+	defer r.workersMux.Unlock()
+
+	b := stats.Budget{
+		Iterations: r.iterations,
+		PerWorker:  r.perWorker,
+		Done:       r.ticksDone,
+	}
+
+	if r.iterations > 0 {
+		b.Met = r.ticksDone >= r.iterations
+	} else {
+		b.Met = r.workersShort == 0
+	}
+
+	if !b.Met {
+		if r.tickErr != nil {
+			b.Reason = fmt.Sprintf("tick failed: %v", r.tickErr)
+		} else {
+			b.Reason = "stopped before the budget was done"
+		}
+	}
+
+	log.Infof("%s", &b)
+	r.stats.RecordBudget(b)
+}
+
+func (r *Runner) numWorkers() int {
+	r.workersMux.Lock()
+	defer r.workersMux.Unlock()
+
+	return len(r.workers)
+}
+
+// closedLoop tells whether workers run ticks back to back, rather than at the
+// rate of the limiter
+func (r *Runner) closedLoop() bool {
+	return r.requestrate == 0 && len(r.stages) == 0
+}
+
+func (r *Runner) pause() {
+	r.pauseMux.Lock()
+	defer r.pauseMux.Unlock()
+
+	if r.resumed == nil {
+		log.Infof("Pausing")
+		r.resumed = make(chan struct{})
+	}
+}
+
+func (r *Runner) resume() {
+	r.pauseMux.Lock()
+	defer r.pauseMux.Unlock()
+
+	if r.resumed != nil {
+		log.Infof("Resuming")
+		close(r.resumed)
+		r.resumed = nil
+	}
+}
+
+func (r *Runner) paused() bool {
+	r.pauseMux.Lock()
+	defer r.pauseMux.Unlock()
+
+	return r.resumed != nil
+}
+
+// waitResumed waits until the run isn't paused, it returns true if it had to
+// wait and an error if the run is done
+func (r *Runner) waitResumed() (bool, error) {
+	r.pauseMux.Lock()
+	resumed := r.resumed
+	r.pauseMux.Unlock()
+
+	if resumed == nil {
+		return false, nil
+	}
+
+	select {
+	case <-resumed:
+		return true, nil
+	case <-r.tickCtx.Done():
+		return true, r.tickCtx.Err()
+	}
 }
 
 func (r *Runner) ticker() {
-	if r.requestrate == 0 {
-		close(r.workChan)
+	if r.closedLoop() {
+		r.feeder()
 		return
 	}
 
-	limiter := rate.NewLimiter(rate.Limit(r.requestrate), 2)
+	if r.arrival != nil {
+		if _, ok := r.arrival.(constantDistribution); !ok {
+			r.arrivalTicker()
+			return
+		}
+	}
 
-	cnt := 0
 	for {
-		if err := limiter.Wait(r.ctx); err != nil {
+		if _, err := r.waitResumed(); err != nil {
+			return
+		}
+
+		if r.limiter.Limit() == 0 {
+			// Nothing to send for now (ex: stage ramping up from 0)
+			select {
+			case <-time.After(stageUpdateInterval):
+				continue
+			case <-r.tickCtx.Done():
+				return
+			}
+		}
+
+		if err := r.wait(); err != nil {
 			if !errors.Is(err, context.Canceled) {
 				log.Errorf("Error waiting: %v", err)
 			}
 			return
 		}
 
+		r.tick(time.Now())
+	}
+}
+
+// arrivalTicker spaces the ticks using the arrival distribution. Gaps are
+// consumed at the limiter's current rate in steps of at most
+// stageUpdateInterval, so that rate changes apply to the gap in progress.
+func (r *Runner) arrivalTicker() {
+	at := time.Now()
+	for {
+		gap := r.arrival.Next()
+		for gap > 0 {
+			waited, err := r.waitResumed()
+			if err != nil {
+				return
+			}
+			if waited {
+				// Don't catch up with the ticks missed while paused
+				at = time.Now()
+			}
+
+			step := stageUpdateInterval
+			if current := float64(r.limiter.Limit()); current > 0 {
+				if d := time.Duration(gap / current * float64(time.Second)); d < step {
+					step = d
+					gap = 0
+				} else {
+					gap -= step.Seconds() * current
+				}
+			}
+
+			// Sleep until the scheduled time rather than for the step, so
+			// that time spent sending doesn't add up over the run
+			at = at.Add(step)
+			if d := time.Until(at); d > 0 {
+				t := time.NewTimer(d)
+				select {
+				case <-t.C:
+				case <-r.tickCtx.Done():
+					t.Stop()
+					return
+				}
+			} else if r.tickCtx.Err() != nil {
+				return
+			}
+		}
+
+		r.tick(at)
+	}
+}
+
+// feeder hands ticks to workers as soon as they are free. Ticks carry no
+// scheduled time as there is no schedule.
+func (r *Runner) feeder() {
+	for {
+		if _, err := r.waitResumed(); err != nil {
+			return
+		}
+
 		select {
 		case r.workChan <- nil:
+		case <-r.tickCtx.Done():
+			return
+		}
+	}
+}
+
+// Ticks which can wait for a free worker, beyond which they are dropped
+const maxBacklog = 1 << 20
+
+// tick hands a tick, scheduled at the given time, to a free worker. Each tick
+// carries the time it was meant to be sent at, so that the time it spends
+// waiting for a free worker is accounted for. When no worker is free the tick
+// waits in the backlog rather than being dropped, so that a stalled target
+// shows in the corrected latency (as with wrk2) instead of in fewer requests.
+func (r *Runner) tick(at time.Time) {
+	r.backlogMux.Lock()
+	defer r.backlogMux.Unlock()
+
+	if len(r.backlog) == 0 {
+		select {
+		case r.workChan <- at:
+			r.sent.Add(1)
+			return
 		default:
-			if cnt == 0 || cnt%100 == 0 {
-				log.Warnf("Target host is likely slow: missed request rate (current=%v)", len(r.workChan))
+		}
+	}
+
+	if len(r.backlog) >= maxBacklog {
+		if cnt := r.missed.Add(1); cnt == 1 || cnt%100 == 1 {
+			log.Errorf("Too many requests waiting for a free worker (%d), dropping requests", len(r.backlog))
+		}
+		return
+	}
+
+	r.backlog = append(r.backlog, at)
+	if cnt := r.late.Add(1); cnt == 1 || cnt%100 == 1 {
+		log.Warnf("Target host is likely slow: requests waiting for a free worker (current=%v)", len(r.backlog))
+	}
+
+	select {
+	case r.backlogged <- struct{}{}:
+	default:
+	}
+}
+
+// dispatcher hands the ticks of the backlog to workers as they become free,
+// oldest first
+func (r *Runner) dispatcher() {
+	for {
+		r.backlogMux.Lock()
+		if len(r.backlog) == 0 {
+			r.backlogMux.Unlock()
+			select {
+			case <-r.backlogged:
+				continue
+			case <-r.tickCtx.Done():
+				return
 			}
-			cnt++
 		}
+		// New ticks queue up behind it until it is handed over
+		at := r.backlog[0]
+		r.backlogMux.Unlock()
+
+		select {
+		case r.workChan <- at:
+			r.sent.Add(1)
+		case <-r.tickCtx.Done():
+			return
+		}
+
+		r.backlogMux.Lock()
+		r.backlog = r.backlog[1:]
+		r.backlogMux.Unlock()
 	}
 }
 
-func (r *Runner) warmupTimer() {
-	if r.warmup == 0 {
+// backlogLen is the number of ticks waiting for a free worker
+func (r *Runner) backlogLen() int {
+	r.backlogMux.Lock()
+	defer r.backlogMux.Unlock()
+
+	return len(r.backlog)
+}
+
+// waiting is the number of ticks not picked up by a worker yet
+func (r *Runner) waiting() int {
+	return len(r.workChan) + r.backlogLen()
+}
+
+// wait blocks until the limiter allows the next tick. Unlike
+// limiter.Wait, long waits are done in steps of stageUpdateInterval so that
+// rate changes while waiting take effect.
+func (r *Runner) wait() error {
+	for {
+		res := r.limiter.Reserve()
+		if !res.OK() {
+			return fmt.Errorf("rate %v doesn't allow any ticks", r.limiter.Limit())
+		}
+
+		delay := res.Delay()
+		done := delay <= stageUpdateInterval
+		if !done {
+			// Give back the token and check again later
+			res.Cancel()
+			delay = stageUpdateInterval
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-r.tickCtx.Done():
+			t.Stop()
+			return r.tickCtx.Err()
+		}
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// warmupTimer resets the metrics once the warmup is done, unless ctx is done
+// first
+func warmupTimer(ctx context.Context, warmup time.Duration, s *stats.Stats) {
+	if warmup == 0 {
 		return
 	}
 
 	// timer.Ticker doesn't have instant tick, so we will wait one more
 	// extra second
-	warmupTimer := time.NewTimer(r.warmup)
+	t := time.NewTimer(warmup)
 
 	select {
-	case <-warmupTimer.C:
-		warmupTimer.Stop()
-		log.Infof("Warmup done (%v seconds)", r.warmup)
-		r.stats.ResetMetrics()
+	case <-t.C:
+		t.Stop()
+		log.Infof("Warmup done (%v seconds)", warmup)
+		s.ResetMetrics()
 		return
-	case <-r.ctx.Done():
-		warmupTimer.Stop()
+	case <-ctx.Done():
+		t.Stop()
 		return
 	}
 }
@@ -162,7 +1043,7 @@ func (r *Runner) durationTimer() {
 	case <-durationTimer.C:
 		durationTimer.Stop()
 		r.Stop()
-	case <-r.ctx.Done():
+	case <-r.tickCtx.Done():
 		durationTimer.Stop()
 		return
 	}
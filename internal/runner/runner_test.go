@@ -0,0 +1,791 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lghttp "github.com/freshworks/load-generator/internal/http"
+	"github.com/freshworks/load-generator/internal/loadgen"
+	"github.com/freshworks/load-generator/internal/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testGenerator struct {
+	ticks *int64
+}
+
+func (g *testGenerator) Init() error     { return nil }
+func (g *testGenerator) InitDone() error { return nil }
+func (g *testGenerator) Finish() error   { return nil }
+func (g *testGenerator) Tick() error {
+	atomic.AddInt64(g.ticks, 1)
+	return nil
+}
+
+func newTestRunner(o Options) (*Runner, *stats.Stats, *int64) {
+	var ticks int64
+	s := stats.New("id", o.RequestRate, o.Concurrency, o.Duration, false)
+	s.Start()
+
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &testGenerator{ticks: &ticks}
+	}
+
+	return New(o, context.Background(), s, newGenerator), s, &ticks
+}
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages("2m:500, 10m:500,30s:2000,1m:0")
+	require.NoError(t, err)
+	assert.Equal(t, []Stage{
+		{2 * time.Minute, 500},
+		{10 * time.Minute, 500},
+		{30 * time.Second, 2000},
+		{time.Minute, 0},
+	}, stages)
+	assert.Equal(t, 2000, maxStageRate(stages))
+	assert.Equal(t, 13*time.Minute+30*time.Second, StagesDuration(stages))
+
+	f, err := os.CreateTemp("", "stages")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# ramp up\n1m:100\n\n2m:100 # hold\n")
+	require.NoError(t, err)
+	f.Close()
+
+	stages, err = ParseStages("@" + f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, []Stage{{time.Minute, 100}, {2 * time.Minute, 100}}, stages)
+
+	for _, s := range []string{"1m", "1m:x", "x:10", "1m:-1", "1m:0,2m:0"} {
+		_, err = ParseStages(s)
+		assert.Errorf(t, err, "%s", s)
+	}
+}
+
+func TestStages(t *testing.T) {
+	o := NewOptions()
+	o.Concurrency = 4
+	o.Stages = []Stage{{time.Second, 20}, {time.Second, 20}}
+
+	r, s, ticks := newTestRunner(*o)
+	defer s.Stop()
+
+	start := time.Now()
+	r.Run()
+
+	// Ramp 0->20 (~10 ticks), then hold at 20 (~20 ticks)
+	assert.InDelta(t, 2*time.Second, time.Since(start), float64(500*time.Millisecond))
+	assert.InDelta(t, 30, atomic.LoadInt64(ticks), 8)
+
+	report := s.Export()
+	require.Equal(t, 2, len(report.Stages))
+	assert.Equal(t, 0, report.Stages[0].From)
+	assert.Equal(t, 20, report.Stages[0].Target)
+	assert.Equal(t, 20, report.Stages[1].From)
+	assert.Equal(t, "1s", report.Stages[1].Duration)
+}
+
+func TestParseDistribution(t *testing.T) {
+	f, err := os.CreateTemp("", "gaps")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# gaps\n10ms\n30\n")
+	require.NoError(t, err)
+	f.Close()
+
+	random := rand.New(rand.NewSource(1))
+	randExpFloat64, randFloat64, randIntn = random.ExpFloat64, random.Float64, random.Intn
+	defer func() {
+		randExpFloat64, randFloat64, randIntn = rand.ExpFloat64, rand.Float64, rand.Intn
+	}()
+
+	for _, s := range []string{"", "constant", "poisson", "uniform", "uniform:0.2", "empirical:" + f.Name()} {
+		d, err := ParseDistribution(s)
+		require.NoErrorf(t, err, "%s", s)
+
+		// Gaps are relative to the mean gap
+		total := 0.0
+		n := 100000
+		for i := 0; i < n; i++ {
+			v := d.Next()
+			require.GreaterOrEqual(t, v, 0.0)
+			total += v
+		}
+		assert.InDeltaf(t, 1, total/float64(n), 0.02, "%s", s)
+	}
+
+	d, err := ParseDistribution("empirical:" + f.Name())
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Contains(t, []float64{0.5, 1.5}, d.Next())
+	}
+
+	for _, s := range []string{"foo", "uniform:2", "uniform:x", "empirical", "empirical:/nonexistent"} {
+		_, err = ParseDistribution(s)
+		assert.Errorf(t, err, "%s", s)
+	}
+}
+
+func TestArrival(t *testing.T) {
+	o := NewOptions()
+	o.RequestRate = 100
+	o.Concurrency = 4
+	o.Duration = 2 * time.Second
+	o.Arrival = poissonDistribution{}
+
+	r, s, ticks := newTestRunner(*o)
+	defer s.Stop()
+
+	r.Run()
+
+	assert.InDelta(t, 200, atomic.LoadInt64(ticks), 50)
+}
+
+func TestUsers(t *testing.T) {
+	o := NewOptions()
+	o.Duration = time.Second
+	o.Users = 3
+	o.ThinkTime = 100 * time.Millisecond
+
+	r, s, ticks := newTestRunner(*o)
+	defer s.Stop()
+
+	r.Run()
+
+	// Each user does ~10 iterations with 100ms think time
+	assert.InDelta(t, 30, atomic.LoadInt64(ticks), 6)
+
+	users := 0
+	for _, res := range s.Export().Results {
+		require.Equal(t, string(stats.UserTrace), res.Type)
+		switch res.Target {
+		case "users":
+			users++
+			assert.InDelta(t, 10, res.Histogram.Count, 2)
+		case "total":
+			assert.Equal(t, "all users", res.SubTarget)
+			assert.InDelta(t, 30, res.Histogram.Count, 6)
+		}
+	}
+	assert.Equal(t, 3, users)
+
+	// The optional interfaces of the wrapped generator are kept
+	newUser := func(g loadgen.Generator) loadgen.Generator {
+		return r.newUserGenerator(func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+			return g
+		})(1, 0, 1, context.Background(), s)
+	}
+	assert.True(t, newUser(&pacedGenerator{}).(loadgen.PacedGenerator).Paced())
+	assert.False(t, newUser(&testGenerator{}).(loadgen.PacedGenerator).Paced())
+
+	sg := &scheduledGenerator{}
+	now := time.Now()
+	newUser(sg).(loadgen.ScheduledGenerator).SetScheduledTime(now)
+	assert.Equal(t, now, sg.scheduled)
+}
+
+// pacedGenerator paces its ticks itself
+type pacedGenerator struct {
+	testGenerator
+}
+
+func (g *pacedGenerator) Paced() bool { return true }
+
+func (g *pacedGenerator) Tick() error {
+	time.Sleep(10 * time.Millisecond)
+	return g.testGenerator.Tick()
+}
+
+func TestPaced(t *testing.T) {
+	var ticks int64
+	s := stats.New("id", 1, 1, 0, false)
+	s.Start()
+	defer s.Stop()
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &pacedGenerator{testGenerator{ticks: &ticks}}
+	}
+
+	o := NewOptions()
+	o.RequestRate = 1
+	o.Duration = 500 * time.Millisecond
+
+	// Ticks are handed over as soon as the worker is free, not at 1 rps
+	require.NoError(t, New(*o, context.Background(), s, newGenerator).Run())
+	assert.Greater(t, atomic.LoadInt64(&ticks), int64(20))
+
+	o.Stages = []Stage{{time.Second, 10}}
+	assert.Error(t, New(*o, context.Background(), s, newGenerator).Run())
+}
+
+// latencyGenerator takes longer as the rate goes up
+type latencyGenerator struct {
+	testGenerator
+	requestrate int
+	stats       *stats.Stats
+}
+
+func (g *latencyGenerator) Tick() error {
+	g.stats.RecordMetric(&stats.TraceInfo{
+		Type:   stats.HttpTrace,
+		Key:    "target",
+		Subkey: "/",
+		Total:  time.Duration(g.requestrate) * time.Millisecond,
+		Status: 200,
+	})
+	return nil
+}
+
+func TestSearch(t *testing.T) {
+	s := stats.New("id", 1, 1, 0, false)
+	s.Start()
+	defer s.Stop()
+
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &latencyGenerator{requestrate: requestrate, stats: s}
+	}
+
+	o := NewOptions()
+	o.Duration = 300 * time.Millisecond
+
+	so := NewSearchOptions()
+	so.SLO, _ = stats.ParseThresholds("p99<100ms")
+
+	best, err := Search(*o, *so, context.Background(), s, newGenerator)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, best, 95)
+	assert.Less(t, best, 100)
+}
+
+type failingGenerator struct {
+	testGenerator
+}
+
+func (g *failingGenerator) Tick() error {
+	if atomic.AddInt64(g.ticks, 1) >= 3 {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func TestIterations(t *testing.T) {
+	o := NewOptions()
+	o.RequestRate = 0
+	o.Concurrency = 4
+	o.Iterations = 100
+
+	r, s, ticks := newTestRunner(*o)
+	defer s.Stop()
+
+	r.Run()
+	assert.Equal(t, int64(100), atomic.LoadInt64(ticks))
+	budget := s.Export().Budget
+	require.NotNil(t, budget)
+	assert.True(t, budget.Met)
+	assert.Equal(t, 100, budget.Done)
+
+	o.Iterations = 0
+	o.IterationsPerWorker = 5
+	o.Concurrency = 3
+	r, s, ticks = newTestRunner(*o)
+	defer s.Stop()
+
+	r.Run()
+	assert.Equal(t, int64(15), atomic.LoadInt64(ticks))
+	budget = s.Export().Budget
+	require.NotNil(t, budget)
+	assert.True(t, budget.Met)
+	assert.Contains(t, s.Report(), "Iteration budget met: 15 iterations done (5 per worker)")
+
+	// Ends early as ticks fail
+	var failed int64
+	s = stats.New("id", 0, 1, 0, false)
+	s.Start()
+	defer s.Stop()
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &failingGenerator{testGenerator{ticks: &failed}}
+	}
+	o.Concurrency = 1
+	New(*o, context.Background(), s, newGenerator).Run()
+
+	budget = s.Export().Budget
+	require.NotNil(t, budget)
+	assert.False(t, budget.Met)
+	assert.Equal(t, 3, budget.Done)
+	assert.Equal(t, "tick failed: failed", budget.Reason)
+}
+
+type flakyGenerator struct {
+	testGenerator
+	initErr error
+	inits   *int64
+}
+
+func (g *flakyGenerator) Init() error {
+	atomic.AddInt64(g.inits, 1)
+	return g.initErr
+}
+
+func (g *flakyGenerator) Tick() error {
+	if atomic.AddInt64(g.ticks, 1)%3 == 0 {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func TestWorkerFailures(t *testing.T) {
+	var ticks, inits int64
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		g := &flakyGenerator{testGenerator{ticks: &ticks}, nil, &inits}
+		if id%2 == 0 {
+			g.initErr = errors.New("init failed")
+		}
+		return g
+	}
+
+	o := NewOptions()
+	o.RequestRate = 100
+	o.Concurrency = 4
+	o.Duration = 100 * time.Millisecond
+
+	// Half the workers fail to initialize
+	o.MaxInitFailures = 40
+	s := stats.New("id", o.RequestRate, o.Concurrency, o.Duration, false)
+	s.Start()
+	defer s.Stop()
+	err := New(*o, context.Background(), s, newGenerator).Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 of 4 workers (50.0%) failed to initialize")
+	assert.Zero(t, atomic.LoadInt64(&ticks))
+
+	// Failed workers are restarted
+	ticks, inits = 0, 0
+	o.MaxInitFailures = 100
+	o.Concurrency = 1
+	o.Duration = 300 * time.Millisecond
+	o.RestartWorkers = true
+	o.RestartBackoff = 10 * time.Millisecond
+	s = stats.New("id", o.RequestRate, o.Concurrency, o.Duration, false)
+	s.Start()
+	defer s.Stop()
+	require.NoError(t, New(*o, context.Background(), s, newGenerator).Run())
+
+	assert.Greater(t, atomic.LoadInt64(&ticks), int64(6))
+	assert.Greater(t, atomic.LoadInt64(&inits), int64(2))
+
+	events := map[string]bool{}
+	for _, e := range s.Export().Workers {
+		events[e.Event] = true
+	}
+	assert.True(t, events[stats.WorkersTickFailed])
+	assert.True(t, events[stats.WorkersRestarted])
+	assert.Contains(t, s.Report(), "Workers over time:")
+}
+
+func TestElasticWorkers(t *testing.T) {
+	var ticks, cancelled int64
+	s := stats.New("id", 100, 20, 0, false)
+	s.Start()
+	defer s.Stop()
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &slowGenerator{testGenerator{ticks: &ticks}, ctx, 50 * time.Millisecond, &cancelled}
+	}
+
+	o := NewOptions()
+	o.RequestRate = 100
+	o.MinWorkers = 1
+	o.MaxWorkers = 20
+	o.Duration = 2500 * time.Millisecond
+
+	r := New(*o, context.Background(), s, newGenerator)
+	assert.Equal(t, 20, r.concurrency)
+	require.NoError(t, r.Run())
+
+	// A worker gets through 20 ticks per second
+	var scaled []int
+	for _, e := range s.Export().Workers {
+		if e.Event == stats.WorkersScaledUp {
+			scaled = append(scaled, e.Workers)
+		}
+	}
+	require.NotEmpty(t, scaled)
+	assert.GreaterOrEqual(t, scaled[len(scaled)-1], 5)
+	assert.LessOrEqual(t, scaled[len(scaled)-1], 20)
+	assert.Contains(t, s.Report(), "scaled up")
+}
+
+func TestStartAt(t *testing.T) {
+	o := NewOptions()
+	o.RequestRate = 0
+	o.Iterations = 1
+	o.StartAt = time.Now().Add(300 * time.Millisecond)
+
+	r, s, ticks := newTestRunner(*o)
+	defer s.Stop()
+
+	start := time.Now()
+	require.NoError(t, r.Run())
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(ticks))
+
+	// The barrier decides the start time
+	o.StartAt = time.Time{}
+	o.StartBarrier = func(ctx context.Context) (time.Time, error) {
+		return time.Now().Add(200 * time.Millisecond), nil
+	}
+	r, s, _ = newTestRunner(*o)
+	defer s.Stop()
+
+	start = time.Now()
+	require.NoError(t, r.Run())
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	o.StartBarrier = func(ctx context.Context) (time.Time, error) {
+		return time.Time{}, errors.New("no server")
+	}
+	r, s, ticks = newTestRunner(*o)
+	defer s.Stop()
+
+	assert.EqualError(t, r.Run(), "start barrier: no server")
+	assert.Zero(t, atomic.LoadInt64(ticks))
+}
+
+func TestControl(t *testing.T) {
+	o := NewOptions()
+	o.RequestRate = 10
+	o.Concurrency = 2
+	o.Duration = 3 * time.Second
+
+	r, s, ticks := newTestRunner(*o)
+	defer s.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		r.Run()
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return atomic.LoadInt64(ticks) > 0 }, time.Second, 10*time.Millisecond)
+
+	h := r.controlHandler()
+	call := func(method, url string) (int, controlStatus) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+
+		var status controlStatus
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return w.Code, status
+	}
+
+	code, status := call("GET", "/status")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, controlStatus{RequestRate: 10, Workers: 2}, status)
+
+	code, status = call("POST", "/rate?value=100")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 100.0, status.RequestRate)
+
+	code, _ = call("POST", "/rate?value=x")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	_, status = call("POST", "/workers?value=4")
+	assert.Equal(t, 4, status.Workers)
+
+	_, status = call("POST", "/pause")
+	assert.True(t, status.Paused)
+	time.Sleep(100 * time.Millisecond)
+	paused := atomic.LoadInt64(ticks)
+	time.Sleep(300 * time.Millisecond)
+	assert.InDelta(t, paused, atomic.LoadInt64(ticks), 2)
+
+	_, status = call("POST", "/resume")
+	assert.False(t, status.Paused)
+	time.Sleep(300 * time.Millisecond)
+	assert.Greater(t, atomic.LoadInt64(ticks), paused+10)
+
+	r.Stop()
+	<-done
+
+	// Neither the rate of the stages nor the workers of the elastic pool can be
+	// changed, they would be set back
+	o.Stages = []Stage{{time.Second, 10}}
+	r, s, _ = newTestRunner(*o)
+	defer s.Stop()
+	h = r.controlHandler()
+	code, _ = call("POST", "/rate?value=100")
+	assert.Equal(t, http.StatusConflict, code)
+
+	o.Stages = nil
+	o.MaxWorkers = 4
+	r, s, _ = newTestRunner(*o)
+	defer s.Stop()
+	h = r.controlHandler()
+	code, _ = call("POST", "/workers?value=2")
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+// slowGenerator takes the given time per tick, unless cancelled
+type slowGenerator struct {
+	testGenerator
+	ctx       context.Context
+	d         time.Duration
+	cancelled *int64
+}
+
+func (g *slowGenerator) Tick() error {
+	select {
+	case <-time.After(g.d):
+		atomic.AddInt64(g.ticks, 1)
+	case <-g.ctx.Done():
+		atomic.AddInt64(g.cancelled, 1)
+	}
+	return nil
+}
+
+// scheduledGenerator records ticks taking the given time, from the time they
+// were scheduled at
+type scheduledGenerator struct {
+	testGenerator
+	stats     *stats.Stats
+	d         time.Duration
+	scheduled time.Time
+}
+
+func (g *scheduledGenerator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
+func (g *scheduledGenerator) Tick() error {
+	time.Sleep(g.d)
+	atomic.AddInt64(g.ticks, 1)
+	g.stats.RecordMetric(&stats.TraceInfo{
+		Type:      stats.HttpTrace,
+		Key:       "target",
+		Subkey:    "/",
+		Total:     g.d,
+		Scheduled: g.scheduled,
+	})
+	return nil
+}
+
+func TestBacklog(t *testing.T) {
+	var ticks int64
+	s := stats.New("id", 100, 1, 0, false)
+	s.Start()
+	defer s.Stop()
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &scheduledGenerator{testGenerator: testGenerator{ticks: &ticks}, stats: s, d: 50 * time.Millisecond}
+	}
+
+	o := NewOptions()
+	o.RequestRate = 100
+	o.Concurrency = 1
+	o.Duration = 1500 * time.Millisecond
+
+	r := New(*o, context.Background(), s, newGenerator)
+	require.NoError(t, r.Run())
+
+	// The worker gets through 30 of the 150 ticks, the others wait for it
+	// (once the work channel is full, in the backlog) rather than being
+	// dropped
+	assert.Zero(t, r.missed.Load())
+	assert.Greater(t, r.late.Load(), int64(0))
+	assert.InDelta(t, 150, r.sent.Load()+int64(r.backlogLen()), 10)
+	assert.InDelta(t, 30, atomic.LoadInt64(&ticks), 4)
+
+	// Time spent waiting in the backlog shows in the corrected latency
+	res := s.Export().Results
+	require.Len(t, res, 1)
+	require.NotNil(t, res[0].Corrected)
+	assert.InDelta(t, 50, res[0].Histogram.Max, 5)
+	assert.Greater(t, res[0].Corrected.Max, 1000.0)
+}
+
+// recordingGenerator records a trace per tick under its key, after taking
+// the given time to initialize
+type recordingGenerator struct {
+	testGenerator
+	stats *stats.Stats
+	key   string
+	init  time.Duration
+}
+
+func (g *recordingGenerator) Init() error {
+	time.Sleep(g.init)
+	return nil
+}
+
+func (g *recordingGenerator) Tick() error {
+	g.stats.RecordMetric(&stats.TraceInfo{
+		Type:   stats.HttpTrace,
+		Key:    g.key,
+		Subkey: "/",
+		Total:  time.Millisecond,
+	})
+	return nil
+}
+
+func TestRunAll(t *testing.T) {
+	s := stats.New("id", 20, 2, 0, false)
+	s.Start()
+	defer s.Stop()
+
+	var runners []*Runner
+	for _, g := range []recordingGenerator{{key: "fast"}, {key: "slow", init: 500 * time.Millisecond}} {
+		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+			return &recordingGenerator{stats: s, key: g.key, init: g.init}
+		}
+
+		o := NewOptions()
+		o.RequestRate = 10
+		o.Warmup = 300 * time.Millisecond
+		o.Duration = time.Second
+		runners = append(runners, New(*o, context.Background(), s, newGenerator))
+	}
+
+	require.NoError(t, RunAll(runners, s))
+
+	// Neither the slow runner's start nor its warmup cut the other's
+	// metrics short
+	report := s.Export()
+	counts := map[string]int64{}
+	for _, r := range report.Results {
+		counts[r.Target] = r.Histogram.Count
+	}
+	assert.InDelta(t, 10, counts["fast"], 2)
+	assert.InDelta(t, 10, counts["slow"], 2)
+
+	// The workers of both runners are counted together
+	workers := 0
+	for _, e := range report.Workers {
+		workers = max(workers, e.Workers)
+	}
+	assert.Equal(t, 2, workers)
+}
+
+func TestStopTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		tick      time.Duration
+		abandoned int
+	}{
+		{200 * time.Millisecond, 0},
+		{5 * time.Second, 2},
+	} {
+		var ticks, cancelled int64
+		s := stats.New("id", 0, 2, 0, false)
+		s.Start()
+		defer s.Stop()
+		newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+			return &slowGenerator{testGenerator{ticks: &ticks}, ctx, tc.tick, &cancelled}
+		}
+
+		o := NewOptions()
+		o.RequestRate = 0
+		o.Concurrency = 2
+		o.Duration = 100 * time.Millisecond
+		o.StopTimeout = 500 * time.Millisecond
+
+		start := time.Now()
+		New(*o, context.Background(), s, newGenerator).Run()
+
+		report := s.Export()
+		if tc.abandoned == 0 {
+			// In-flight ticks were done
+			assert.Equal(t, int64(2), atomic.LoadInt64(&ticks))
+			assert.Zero(t, atomic.LoadInt64(&cancelled))
+			assert.Nil(t, report.Abandoned)
+		} else {
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Zero(t, atomic.LoadInt64(&ticks))
+			assert.Equal(t, int64(2), atomic.LoadInt64(&cancelled))
+			require.NotNil(t, report.Abandoned)
+			assert.Equal(t, tc.abandoned, *report.Abandoned)
+			assert.Contains(t, s.Report(), "Abandoned requests (in flight at stop timeout): 2")
+		}
+	}
+}
+
+func TestStopTimeoutHttp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-req.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	s := stats.New("id", 0, 2, 0, false)
+	s.Start()
+	defer s.Stop()
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		o := lghttp.NewOptions()
+		o.Url = *u
+		return lghttp.NewGenerator(id, *o, ctx, requestrate, s)
+	}
+
+	o := NewOptions()
+	o.RequestRate = 0
+	o.Concurrency = 2
+	o.Duration = 100 * time.Millisecond
+	o.StopTimeout = 300 * time.Millisecond
+
+	require.NoError(t, New(*o, context.Background(), s, newGenerator).Run())
+
+	// Cancelled requests are abandoned, not failed
+	report := s.Export()
+	require.NotNil(t, report.Abandoned)
+	assert.Equal(t, 2, *report.Abandoned)
+	assert.Empty(t, report.Results)
+}
+
+func TestInterrupt(t *testing.T) {
+	var ticks, cancelled int64
+	s := stats.New("id", 0, 2, 0, false)
+	s.Start()
+	defer s.Stop()
+	newGenerator := func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &slowGenerator{testGenerator{ticks: &ticks}, ctx, 5 * time.Second, &cancelled}
+	}
+
+	o := NewOptions()
+	o.RequestRate = 0
+	o.Concurrency = 2
+
+	assert.False(t, Interrupt())
+
+	done := make(chan error)
+	go func() {
+		done <- New(*o, context.Background(), s, newGenerator).Run()
+	}()
+
+	// The first interrupt waits for the ticks in flight, the second one
+	// abandons them
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, Interrupt())
+	select {
+	case <-done:
+		t.Fatal("run stopped without waiting for the ticks in flight")
+	case <-time.After(200 * time.Millisecond):
+	}
+	// Nothing left to stop gracefully, the caller stops on its own
+	assert.False(t, Interrupt())
+	require.NoError(t, <-done)
+
+	assert.Equal(t, int64(2), atomic.LoadInt64(&cancelled))
+	report := s.Export()
+	require.NotNil(t, report.Abandoned)
+	assert.Equal(t, 2, *report.Abandoned)
+	assert.False(t, Interrupt())
+}
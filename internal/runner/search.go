@@ -0,0 +1,193 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/freshworks/load-generator/internal/loadgen"
+	"github.com/freshworks/load-generator/internal/stats"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+)
+
+// A step fails if more than this percentage of its ticks couldn't be sent on
+// time, as no worker was free (ie the requested rate wasn't reached)
+const maxMissedPercent = 1.0
+
+type SearchOptions struct {
+	// Thresholds every result of a step has to meet
+	SLO []stats.Threshold
+	// Rate of the first step, doubled until the SLO is breached
+	StartRate int
+	// Upper bound of the rate, 0 for no limit
+	MaxRate int
+	// Search stops when the gap between the highest passing and the lowest
+	// failing rate is within this fraction of the rate
+	Precision float64
+	// Concurrency of each step, 0 to use the step's rate
+	Concurrency int
+}
+
+func NewSearchOptions() *SearchOptions {
+	return &SearchOptions{
+		StartRate: 10,
+		Precision: 0.05,
+	}
+}
+
+type searchStep struct {
+	rate     int
+	observed []float64
+	missed   float64
+	pass     bool
+
+	interrupted bool
+}
+
+// Search finds the highest request rate meeting the SLO. Each step is a full
+// run (with warmup and duration from o) at a given rate, the rate is doubled
+// until the SLO is breached and then binary searched. A summary of the steps
+// is printed at the end and the highest passing rate is returned (0 if none).
+func Search(o Options, so SearchOptions, ctx context.Context, s *stats.Stats, newGenerator loadgen.NewGenerator) (int, error) {
+	var steps []searchStep
+	best, worst := 0, 0
+
+	rate := so.StartRate
+	for ctx.Err() == nil {
+		step, err := runSearchStep(o, so, rate, ctx, s, newGenerator)
+		if err != nil {
+			return 0, err
+		}
+		if ctx.Err() != nil || step.interrupted {
+			// Interrupted, partial step isn't meaningful
+			break
+		}
+		steps = append(steps, step)
+
+		// Only the first step waits for the scheduled start
+		o.StartAt, o.StartBarrier = time.Time{}, nil
+
+		if step.pass {
+			best = rate
+		} else {
+			worst = rate
+		}
+
+		if worst == 0 {
+			if so.MaxRate > 0 && rate >= so.MaxRate {
+				break
+			}
+			rate *= 2
+			if so.MaxRate > 0 && rate > so.MaxRate {
+				rate = so.MaxRate
+			}
+			continue
+		}
+
+		gap := float64(worst) * so.Precision
+		if gap < 1 {
+			gap = 1
+		}
+		if float64(worst-best) <= gap {
+			break
+		}
+		rate = (best + worst) / 2
+	}
+
+	fmt.Print(searchSummary(so, steps, best))
+
+	return best, nil
+}
+
+func runSearchStep(o Options, so SearchOptions, rate int, ctx context.Context, s *stats.Stats, newGenerator loadgen.NewGenerator) (searchStep, error) {
+	log.Infof("Search step: %d rps", rate)
+
+	o.RequestRate = rate
+	o.Concurrency = so.Concurrency
+	if o.Concurrency == 0 {
+		o.Concurrency = rate
+	}
+
+	r := New(o, ctx, s, newGenerator)
+	if err := r.run(); err != nil {
+		return searchStep{}, err
+	}
+
+	step := searchStep{rate: rate, pass: true, interrupted: r.interrupted.Load()}
+
+	// Late ticks are either sent or still waiting
+	scheduled := r.sent.Load() + int64(r.backlogLen()) + r.missed.Load()
+	if scheduled > 0 {
+		step.missed = 100 * float64(r.late.Load()+r.missed.Load()) / float64(scheduled)
+	}
+	if step.missed > maxMissedPercent {
+		step.pass = false
+	}
+
+	results := s.Export().Results
+	for _, t := range so.SLO {
+		var worst float64
+		for i, res := range results {
+			v, ok := t.Check(&res)
+			if !ok {
+				step.pass = false
+			}
+			if i == 0 || t.Worse(v, worst) {
+				worst = v
+			}
+		}
+		step.observed = append(step.observed, worst)
+	}
+
+	if len(results) == 0 {
+		step.pass = false
+	}
+
+	log.Infof("Search step: %d rps %s", rate, passFail(step.pass))
+
+	return step, nil
+}
+
+func searchSummary(so SearchOptions, steps []searchStep, best int) string {
+	var out strings.Builder
+
+	slo := make([]string, 0, len(so.SLO))
+	for _, t := range so.SLO {
+		slo = append(slo, t.String())
+	}
+	fmt.Fprintf(&out, "\nMax throughput search (SLO: %s):\n", strings.Join(slo, ","))
+
+	hdrs := []string{"Step", "Rate"}
+	hdrs = append(hdrs, slo...)
+	hdrs = append(hdrs, "Late", "Result")
+
+	table := tablewriter.NewTable(&out)
+	table.Header(hdrs)
+	for i, step := range steps {
+		row := []string{fmt.Sprint(i + 1), fmt.Sprint(step.rate)}
+		for j, t := range so.SLO {
+			row = append(row, t.FormatValue(step.observed[j]))
+		}
+		row = append(row, fmt.Sprintf("%.2f%%", step.missed), passFail(step.pass))
+		table.Append(row)
+	}
+	table.Render()
+
+	if best == 0 {
+		fmt.Fprintf(&out, "\nNo rate met the SLO\n")
+	} else {
+		fmt.Fprintf(&out, "\nMax rate meeting the SLO: %d rps\n", best)
+	}
+
+	return out.String()
+}
+
+func passFail(pass bool) string {
+	if pass {
+		return "pass"
+	}
+
+	return "fail"
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// handleSignals pauses/resumes the run on SIGUSR1 and resets the metrics on
+// SIGUSR2, until the returned function is called
+func (r *Runner) handleSignals() func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				switch sig {
+				case syscall.SIGUSR1:
+					if r.paused() {
+						r.resume()
+					} else {
+						r.pause()
+					}
+				case syscall.SIGUSR2:
+					log.Infof("Resetting metrics (SIGUSR2)")
+					r.stats.ResetMetrics()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
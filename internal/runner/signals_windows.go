@@ -0,0 +1,6 @@
+package runner
+
+// No SIGUSR1/SIGUSR2 on windows, use the control API instead
+func (r *Runner) handleSignals() func() {
+	return func() {}
+}
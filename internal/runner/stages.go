@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freshworks/load-generator/internal/stats"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// How often the rate and workers are adjusted while ramping
+var stageUpdateInterval = 100 * time.Millisecond
+
+// Stage ramps the request rate linearly from the previous stage's target
+// (0 for the first stage) to Target over Duration. A stage with the same
+// target as the previous one holds the rate.
+type Stage struct {
+	Duration time.Duration
+	Target   int
+}
+
+// ParseStages parses comma (or newline) separated "<duration>:<rate>"
+// stages, ex: "2m:500,10m:500,30s:2000,1m:0". If the value starts with '@',
+// stages are read from the given file instead.
+func ParseStages(s string) ([]Stage, error) {
+	if strings.HasPrefix(s, "@") {
+		b, err := os.ReadFile(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	}
+
+	stages := []Stage{}
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		for _, v := range strings.Split(line, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+
+			p := strings.Split(v, ":")
+			if len(p) != 2 {
+				return nil, fmt.Errorf("invalid stage %q, expected <duration>:<rate>", v)
+			}
+
+			d, err := time.ParseDuration(strings.TrimSpace(p[0]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid stage %q: %v", v, err)
+			}
+
+			t, err := strconv.Atoi(strings.TrimSpace(p[1]))
+			if err != nil || t < 0 {
+				return nil, fmt.Errorf("invalid stage %q: rate must be a non-negative integer", v)
+			}
+
+			stages = append(stages, Stage{Duration: d, Target: t})
+		}
+	}
+
+	if len(stages) > 0 && maxStageRate(stages) == 0 {
+		return nil, fmt.Errorf("invalid stages %q: all stages have zero rate", s)
+	}
+
+	return stages, nil
+}
+
+func maxStageRate(stages []Stage) int {
+	max := 0
+	for _, s := range stages {
+		if s.Target > max {
+			max = s.Target
+		}
+	}
+
+	return max
+}
+
+func StagesDuration(stages []Stage) time.Duration {
+	var d time.Duration
+	for _, s := range stages {
+		d += s.Duration
+	}
+
+	return d
+}
+
+// stager walks through the stages, adjusting the rate (and number of workers
+// proportionally, up to the configured concurrency at the peak rate) and
+// stops the run after the last stage.
+func (r *Runner) stager() {
+	maxRate := maxStageRate(r.stages)
+
+	t := time.NewTicker(stageUpdateInterval)
+	defer t.Stop()
+
+	from := 0
+	for i, st := range r.stages {
+		log.Infof("Stage %d: %d -> %d rps over %v", i+1, from, st.Target, st.Duration)
+		r.stats.RecordStage(stats.Stage{
+			Start:    time.Now(),
+			Duration: st.Duration.String(),
+			From:     from,
+			Target:   st.Target,
+		})
+
+		start := time.Now()
+		for {
+			elapsed := time.Since(start)
+			if elapsed >= st.Duration {
+				break
+			}
+
+			current := float64(from) + float64(st.Target-from)*float64(elapsed)/float64(st.Duration)
+			r.setStageRate(current, maxRate)
+
+			select {
+			case <-t.C:
+			case <-r.tickCtx.Done():
+				return
+			}
+		}
+
+		from = st.Target
+		r.setStageRate(float64(from), maxRate)
+	}
+
+	log.Infof("All stages done")
+	r.Stop()
+}
+
+func (r *Runner) setStageRate(current float64, maxRate int) {
+	r.limiter.SetLimit(rate.Limit(current))
+
+	n := int(math.Ceil(float64(r.concurrency) * current / float64(maxRate)))
+	if n < 1 {
+		n = 1
+	}
+
+	if n != r.numWorkers() {
+		log.Debugf("Changing workers to %d (rate=%.2f)", n, current)
+		r.setWorkers(n, "")
+	}
+}
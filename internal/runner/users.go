@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/freshworks/load-generator/internal/loadgen"
+	"github.com/freshworks/load-generator/internal/stats"
+)
+
+// userGenerator runs the wrapped generator as a virtual user: every Tick is
+// one iteration, followed by the think time before the next one. Iterations
+// are recorded per user, so the report shows the iteration rate of each user.
+type userGenerator struct {
+	loadgen.Generator
+	user      string
+	thinkTime time.Duration
+	thinkDist Distribution
+	// Thinking stops as soon as the run is stopped
+	ctx   context.Context
+	stats *stats.Stats
+}
+
+func (r *Runner) newUserGenerator(newGenerator loadgen.NewGenerator) loadgen.NewGenerator {
+	return func(id int, requestrate int, concurrency int, ctx context.Context, s *stats.Stats) loadgen.Generator {
+		return &userGenerator{
+			Generator: newGenerator(id, requestrate, concurrency, ctx, s),
+			user:      fmt.Sprintf("user %d", id),
+			thinkTime: r.thinkTime,
+			thinkDist: r.thinkDist,
+			ctx:       r.tickCtx,
+			stats:     s,
+		}
+	}
+}
+
+func (u *userGenerator) Tick() error {
+	start := time.Now()
+	err := u.Generator.Tick()
+	total := time.Since(start)
+
+	u.record("total", "all users", total, err)
+	u.record("users", u.user, total, err)
+
+	if err != nil {
+		return err
+	}
+
+	u.think()
+
+	return nil
+}
+
+// SetScheduledTime is passed on to the wrapped generator, if it reports
+// latency from the scheduled time
+func (u *userGenerator) SetScheduledTime(t time.Time) {
+	if sg, ok := u.Generator.(loadgen.ScheduledGenerator); ok {
+		sg.SetScheduledTime(t)
+	}
+}
+
+// Paced tells whether the wrapped generator paces its ticks itself
+func (u *userGenerator) Paced() bool {
+	pg, ok := u.Generator.(loadgen.PacedGenerator)
+	return ok && pg.Paced()
+}
+
+// Stop stops the waits within the ticks of the wrapped generator, if any
+func (u *userGenerator) Stop() {
+	if sg, ok := u.Generator.(loadgen.StoppableGenerator); ok {
+		sg.Stop()
+	}
+}
+
+func (u *userGenerator) record(key, subkey string, total time.Duration, err error) {
+	u.stats.RecordMetric(&stats.TraceInfo{
+		Type:        stats.UserTrace,
+		Key:         key,
+		Subkey:      subkey,
+		Total:       total,
+		Error:       err != nil,
+		ErrorReason: stats.ErrorReason(err),
+	})
+}
+
+func (u *userGenerator) think() {
+	if u.thinkTime == 0 {
+		return
+	}
+
+	d := time.Duration(float64(u.thinkTime) * u.thinkDist.Next())
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-u.ctx.Done():
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"sort"
+	"time"
 
 	chartjs "github.com/brentp/go-chartjs"
 	"github.com/brentp/go-chartjs/types"
@@ -37,6 +38,8 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprintf(w, "Server internal error: %v", err)
 			return
 		}
+	case "/metrics":
+		lg.metrics.ServeHTTP(w, r)
 	case "/reset":
 		lg.reset()
 		fmt.Fprint(w, "OK")
@@ -110,9 +113,84 @@ func graphs(w io.Writer, report *stats.Report) error {
 		return cs[i].Label < cs[j].Label
 	})
 
+	timeCharts, err := intervalGraphs(report, colors)
+	if err != nil {
+		return err
+	}
+	cs = append(cs, timeCharts...)
+
 	return chartjs.SaveCharts(w, nil, cs...)
 }
 
+// Percentile of the latency shown over time
+const intervalGraphPercentile = 99.0
+
+// intervalGraphs charts the latency of the results over time, from their
+// interval snapshots
+func intervalGraphs(report *stats.Report, colors []*types.RGBA) ([]chartjs.Chart, error) {
+	var origin time.Time
+	for _, r := range report.Results {
+		if len(r.Intervals) > 0 && (origin.IsZero() || r.Intervals[0].Start.Before(origin)) {
+			origin = r.Intervals[0].Start
+		}
+	}
+
+	charts := map[string]*chartjs.Chart{}
+	for _, r := range report.Results {
+		if len(r.Intervals) == 0 {
+			continue
+		}
+
+		chart, ok := charts[r.Target]
+		if !ok {
+			title := fmt.Sprintf("%s: p%v over time", r.Target, intervalGraphPercentile)
+			chart = &chartjs.Chart{Label: title}
+			chart.Options.Responsive = chartjs.False
+			chart.Options.Title = &chartjs.Title{Display: chartjs.True, Text: title}
+			_, err := chart.AddXAxis(chartjs.Axis{Type: chartjs.Linear, Position: chartjs.Bottom,
+				ScaleLabel: &chartjs.ScaleLabel{LabelString: "Time (s)", Display: chartjs.True}})
+			if err != nil {
+				return nil, err
+			}
+			_, err = chart.AddYAxis(chartjs.Axis{Type: chartjs.Linear, Position: chartjs.Left,
+				ScaleLabel: &chartjs.ScaleLabel{LabelString: "Latency (ms)", Display: chartjs.True}})
+			if err != nil {
+				return nil, err
+			}
+			charts[r.Target] = chart
+		}
+
+		var xys xy
+		for _, i := range r.Intervals {
+			for _, p := range i.Percentiles {
+				if p.Percentile == intervalGraphPercentile {
+					xys.x = append(xys.x, i.Start.Sub(origin).Seconds())
+					xys.y = append(xys.y, p.Value)
+				}
+			}
+		}
+
+		subtarget := r.SubTarget
+		if q, ok := report.DigestToQuery[subtarget]; ok {
+			subtarget = q
+		}
+
+		color := colors[len(chart.Data.Datasets)%len(colors)]
+		chart.AddDataset(chartjs.Dataset{Data: xys, BorderColor: color, Label: subtarget, Fill: chartjs.False,
+			PointRadius: 3, BackgroundColor: color})
+	}
+
+	cs := make([]chartjs.Chart, 0, len(charts))
+	for _, c := range charts {
+		cs = append(cs, *c)
+	}
+	sort.SliceStable(cs[:], func(i, j int) bool {
+		return cs[i].Label < cs[j].Label
+	})
+
+	return cs, nil
+}
+
 var indexContent = `
 <head>
   <title>Load Generator</title>
@@ -148,6 +226,7 @@ var indexContent = `
 <tr class='home-row'><td class='home-data'><a href='print'>print</a></td><td class='home-data'>print metrics</td></tr>
 <tr class='home-row'><td class='home-data'><a href='report'>report</a></td><td class='home-data'>report of metrics in json</td></tr>
 <tr class='home-row'><td class='home-data'><a href='graphs'>graphs</a></td><td class='home-data'>metrics graphs</td></tr>
+<tr class='home-row'><td class='home-data'><a href='metrics'>metrics</a></td><td class='home-data'>metrics in Prometheus format</td></tr>
 <tr class='home-row'><td class='home-data'><form action='reset' method='post' class='home-form'><button>reset</button></form></td><td class='home-data'>reset metrics</td></tr>
     </tbody>
   </table>
@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/rpc"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/freshworks/load-generator/internal/stats"
 	"github.com/sirupsen/logrus"
@@ -22,27 +22,90 @@ type LG struct {
 	importCount  int
 	mux          sync.Mutex
 	exportReport string
+	exportFormat string
+	thresholds   []stats.Threshold
 	importReport string
 	report       *stats.Report
+	metrics      http.Handler
+
+	barrierClients int
+	barrierDelay   time.Duration
+	barrierMux     sync.Mutex
+	barrierWaiting int
+	barrier        *barrierRound
+}
+
+type Options struct {
+	// Report to display instead of accepting metrics from clients
+	ImportReport string
+	// Write the aggregated report to this file, in ExportFormat (see
+	// stats.Report.Write)
+	ExportReport string
+	ExportFormat string
+	Thresholds   []stats.Threshold
+	// Number of clients the start barrier waits for (0 for no barrier), and
+	// how long after the last one joined they all start
+	BarrierClients int
+	BarrierDelay   time.Duration
 }
 
-func Run(s *stats.Stats, addr string, ctx context.Context, importReport, exportReport string) error {
-	lg = &LG{stats: s, importReport: importReport, exportReport: exportReport}
+func NewOptions() *Options {
+	return &Options{
+		ExportFormat: stats.FormatJSON,
+		BarrierDelay: 5 * time.Second,
+	}
+}
+
+// BarrierArgs identifies a client waiting at the start barrier
+type BarrierArgs struct {
+	ID   string
+	Host string
+}
+
+// BarrierReply tells a client when to start, Delay is from the time of the
+// reply so that clients don't depend on their clocks being in sync
+type BarrierReply struct {
+	StartAt time.Time
+	Delay   time.Duration
+}
+
+// Clients waiting at the start barrier, released together
+type barrierRound struct {
+	release chan struct{}
+	startAt time.Time
+}
+
+func Run(s *stats.Stats, addr string, ctx context.Context, o Options) error {
+	lg = &LG{
+		stats:          s,
+		importReport:   o.ImportReport,
+		exportReport:   o.ExportReport,
+		exportFormat:   o.ExportFormat,
+		thresholds:     o.Thresholds,
+		barrierClients: o.BarrierClients,
+		barrierDelay:   o.BarrierDelay,
+		barrier:        &barrierRound{release: make(chan struct{})},
+		metrics:        s.PrometheusHandler(),
+	}
 	lg.reset()
 
-	if importReport != "" {
-		r, err := os.Open(importReport)
+	if o.ImportReport != "" {
+		r, err := os.Open(o.ImportReport)
 		if err != nil {
 			return err
 		}
 
 		var report stats.Report
 		if err = json.NewDecoder(r).Decode(&report); err != nil {
-			return fmt.Errorf("error importing report (%s): %s", importReport, err)
+			return fmt.Errorf("error importing report (%s): %s", o.ImportReport, err)
 		}
 		lg.report = &report
 	}
 
+	if o.BarrierClients > 0 {
+		logrus.Infof("Start barrier: waiting for %d clients", o.BarrierClients)
+	}
+
 	rpc.Register(lg)
 	rpc.HandleHTTP()
 
@@ -82,23 +145,51 @@ func (l *LG) ImportReport(report *stats.Report, reply *int) error {
 	return l.writeReport()
 }
 
+// Barrier waits until BarrierClients clients are waiting, and then tells all
+// of them to start BarrierDelay later. Clients joining afterwards wait for the
+// next round.
+func (l *LG) Barrier(args *BarrierArgs, reply *BarrierReply) error {
+	if l.barrierClients == 0 {
+		return fmt.Errorf("server has no start barrier, run it with --barrier <clients>")
+	}
+
+	l.barrierMux.Lock()
+	round := l.barrier
+	l.barrierWaiting++
+	logrus.Infof("Client %s (%s) at the start barrier, %d/%d", args.Host, args.ID, l.barrierWaiting, l.barrierClients)
+	if l.barrierWaiting == l.barrierClients {
+		round.startAt = time.Now().Add(l.barrierDelay)
+		logrus.Infof("All clients at the start barrier, starting at %v", round.startAt.Format(time.RFC3339Nano))
+		close(round.release)
+
+		l.barrierWaiting = 0
+		l.barrier = &barrierRound{release: make(chan struct{})}
+	}
+	l.barrierMux.Unlock()
+
+	<-round.release
+	reply.StartAt = round.startAt
+	reply.Delay = time.Until(round.startAt)
+
+	return nil
+}
+
 func (l *LG) writeReport() error {
 	if l.exportReport == "" {
 		return nil
 	}
 
-	res := l.stats.Export()
-	j, err := json.MarshalIndent(res, "", " ")
+	f, err := os.OpenFile(l.exportReport, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(l.exportReport, j, os.ModePerm)
-	if err != nil {
+	if err := l.stats.Export().Write(f, l.exportFormat, l.thresholds); err != nil {
+		f.Close()
 		return err
 	}
 
-	return nil
+	return f.Close()
 }
 
 func (l *LG) printMetrics(w io.Writer) {
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -38,6 +39,7 @@ type Generator struct {
 	stats     *stats.Stats
 	tlsConfig *tls.Config
 	client    *smtp.Client
+	scheduled time.Time
 }
 
 type GeneratorOptions struct {
@@ -112,13 +114,18 @@ func (g *Generator) Finish() error {
 	return nil
 }
 
+func (g *Generator) SetScheduledTime(t time.Time) {
+	g.scheduled = t
+}
+
 func (g *Generator) SendMail(sender, receiver, subject, body string) error {
 	var c *smtp.Client
 	var err error
+	var size int64
 
 	startTime := time.Now()
 	defer func() {
-		g.recordMetric(time.Since(startTime), err)
+		g.recordMetric(time.Since(startTime), size, err)
 	}()
 
 	if g.o.DisableConnectionReuse {
@@ -151,7 +158,7 @@ func (g *Generator) SendMail(sender, receiver, subject, body string) error {
 
 	// TODO: add mail headers (to, from, subject etc)
 	// TODO: verify the body is not empty
-	_, err = io.Copy(wc, strings.NewReader(body))
+	size, err = io.Copy(wc, strings.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -164,16 +171,21 @@ func (g *Generator) SendMail(sender, receiver, subject, body string) error {
 	return nil
 }
 
-func (g *Generator) recordMetric(d time.Duration, err error) {
+// recordMetric records a mail sent in d, size being the bytes of its body
+func (g *Generator) recordMetric(d time.Duration, size int64, err error) {
 	var traceInfo stats.TraceInfo
 	traceInfo.Type = stats.SmtpTrace
 	traceInfo.Key = g.o.Target
 	traceInfo.Subkey = g.o.Target
+	traceInfo.Scheduled = g.scheduled
 	if err != nil && !errors.Is(err, context.Canceled) {
 		traceInfo.Error = true
+		traceInfo.ErrorReason = errorReason(err)
 	}
+	traceInfo.Total = d
 	if !traceInfo.Error {
-		traceInfo.Total = d
+		traceInfo.Sized = true
+		traceInfo.RequestSize = size
 	}
 
 	g.stats.RecordMetric(&traceInfo)
@@ -209,3 +221,14 @@ func (g *Generator) getSmtpClient() (*smtp.Client, error) {
 
 	return c, nil
 }
+
+// errorReason gives the reply code of SMTP errors (ex: code 550),
+// stats.ErrorReason for the others
+func errorReason(err error) string {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return fmt.Sprintf("code %d", smtpErr.Code)
+	}
+
+	return stats.ErrorReason(err)
+}
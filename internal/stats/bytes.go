@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Highest request/response size the size histograms track (1 TB), with a
+// precision of 2 significant digits which is plenty for sizes
+const (
+	maxSizeValue  = int64(1) << 40
+	sizeDigits    = 2
+	bytesPerMByte = 1000 * 1000
+)
+
+// ByteData is the throughput of a result: bytes sent and received in total,
+// per second and per request
+type ByteData struct {
+	RequestBytes  int64
+	ResponseBytes int64
+	// Bytes per second, over the time the results were collected in
+	RequestRate  float64
+	ResponseRate float64
+	// Sizes in bytes
+	RequestSize          HistogramData
+	ResponseSize         HistogramData
+	RequestSizeSnapshot  *hdrhistogram.Snapshot `json:"-"`
+	ResponseSizeSnapshot *hdrhistogram.Snapshot `json:"-"`
+}
+
+func newSizeHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1, maxSizeValue, sizeDigits)
+}
+
+// AddSizes records the bytes sent and received by a request
+func (m *Metrics) AddSizes(request, response int64) {
+	if m.requestSize == nil {
+		m.requestSize = newSizeHistogram()
+		m.responseSize = newSizeHistogram()
+	}
+
+	m.RequestBytes += request
+	m.ResponseBytes += response
+
+	if err := m.requestSize.RecordValue(request); err != nil {
+		log.Warnf("Failed to add value to request size histogram: %s", err.Error())
+	}
+	if err := m.responseSize.RecordValue(response); err != nil {
+		log.Warnf("Failed to add value to response size histogram: %s", err.Error())
+	}
+}
+
+// exportBytes gives the throughput of the metrics collected over elapsed,
+// nil if no sizes were recorded
+func (m *Metrics) exportBytes(elapsed time.Duration) *ByteData {
+	if m.requestSize == nil {
+		return nil
+	}
+
+	b := &ByteData{
+		RequestBytes:         m.RequestBytes,
+		ResponseBytes:        m.ResponseBytes,
+		RequestSize:          histogramData(m.requestSize, 1),
+		ResponseSize:         histogramData(m.responseSize, 1),
+		RequestSizeSnapshot:  m.requestSize.Export(),
+		ResponseSizeSnapshot: m.responseSize.Export(),
+	}
+
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		b.RequestRate = float64(m.RequestBytes) / seconds
+		b.ResponseRate = float64(m.ResponseBytes) / seconds
+	}
+
+	return b
+}
+
+// importBytes adds the throughput of a result to the metrics
+func (m *Metrics) importBytes(b *ByteData) {
+	if m.requestSize == nil {
+		m.requestSize = newSizeHistogram()
+		m.responseSize = newSizeHistogram()
+	}
+
+	m.RequestBytes += b.RequestBytes
+	m.ResponseBytes += b.ResponseBytes
+
+	if b.RequestSizeSnapshot != nil {
+		if d := m.requestSize.Merge(hdrhistogram.Import(b.RequestSizeSnapshot)); d != 0 {
+			log.Warnf("Dropped request size metrics: %v", d)
+		}
+	}
+	if b.ResponseSizeSnapshot != nil {
+		if d := m.responseSize.Merge(hdrhistogram.Import(b.ResponseSizeSnapshot)); d != 0 {
+			log.Warnf("Dropped response size metrics: %v", d)
+		}
+	}
+}
+
+func bytesHeaders() []string {
+	return []string{"SentMB", "ReceivedMB", "SentMBPerSec", "ReceivedMBPerSec",
+		"AvgRequest", "MaxRequest", "AvgResponse", "p99Response", "MaxResponse"}
+}
+
+func bytesRecords(m *Metrics, elapsed time.Duration) []string {
+	b := m.exportBytes(elapsed)
+	mb := func(v float64) string { return strconv.FormatFloat(v/bytesPerMByte, 'f', 3, 64) }
+	size := func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) }
+
+	return []string{
+		mb(float64(b.RequestBytes)),
+		mb(float64(b.ResponseBytes)),
+		mb(b.RequestRate),
+		mb(b.ResponseRate),
+		size(b.RequestSize.Avg),
+		size(b.RequestSize.Max),
+		size(b.ResponseSize.Avg),
+		size(float64(m.responseSize.ValueAtQuantile(99))),
+		size(b.ResponseSize.Max),
+	}
+}
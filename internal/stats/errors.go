@@ -0,0 +1,123 @@
+package stats
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"syscall"
+)
+
+// Common error reasons
+const (
+	ErrorTimeout           = "timeout"
+	ErrorCanceled          = "canceled"
+	ErrorConnectionRefused = "connection refused"
+	ErrorConnectionReset   = "connection reset"
+	ErrorBrokenPipe        = "broken pipe"
+	ErrorDNS               = "dns"
+	ErrorTLS               = "tls"
+	ErrorEOF               = "eof"
+	ErrorOther             = "other"
+	// Failed requests whose generator didn't give a reason
+	ErrorUnknown = "unknown"
+)
+
+// Distinct reasons counted per result, others are counted as ErrorOther so
+// that a generator giving too specific reasons doesn't take up all the
+// memory
+const maxErrorReasons = 20
+
+// Reasons shown per result in the table
+const topErrorReasons = 5
+
+// ErrorCount is the number of failed requests of a result for a reason,
+// results give them most frequent first
+type ErrorCount struct {
+	Reason string
+	Count  int
+}
+
+// ErrorReason classifies the errors common to all the generators (timeouts,
+// connection and TLS failures...), ErrorOther for the rest. Generators check
+// for the errors of their protocol first (ex: status codes) and fall back on
+// it.
+func ErrorReason(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrorConnectionReset
+	case errors.Is(err, syscall.EPIPE):
+		return ErrorBrokenPipe
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return ErrorTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorEOF
+	}
+
+	return ErrorOther
+}
+
+// addErrorReasons counts n failed requests for the reason
+func (m *Metrics) addErrorReasons(reason string, n int) {
+	if reason == "" {
+		reason = ErrorUnknown
+	}
+
+	if m.errorReasons == nil {
+		m.errorReasons = map[string]int{}
+	}
+
+	// Room is kept for ErrorOther
+	if _, ok := m.errorReasons[reason]; !ok && len(m.errorReasons) >= maxErrorReasons-1 {
+		reason = ErrorOther
+	}
+
+	m.errorReasons[reason] += n
+}
+
+// exportErrorReasons gives the error reasons of the metrics, most frequent
+// first
+func (m *Metrics) exportErrorReasons() []ErrorCount {
+	if len(m.errorReasons) == 0 {
+		return nil
+	}
+
+	reasons := make([]ErrorCount, 0, len(m.errorReasons))
+	for r, n := range m.errorReasons {
+		reasons = append(reasons, ErrorCount{r, n})
+	}
+
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+
+	return reasons
+}
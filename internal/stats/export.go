@@ -0,0 +1,285 @@
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report formats
+const (
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+	FormatJUnit = "junit"
+)
+
+// ValidFormat tells whether a report can be written in the format
+func ValidFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatCSV, FormatJUnit:
+		return nil
+	}
+
+	return fmt.Errorf("invalid report format %q, should be json, csv or junit", format)
+}
+
+// Write writes the report in the given format: json (the whole report), csv
+// (a row per result) or junit (a testcase per result, failed if it breaches
+// any of the thresholds)
+func (r *Report) Write(w io.Writer, format string, thresholds []Threshold) error {
+	switch format {
+	case FormatJSON:
+		j, err := json.MarshalIndent(r, "", " ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(j)
+		return err
+	case FormatCSV:
+		return r.writeCSV(w)
+	case FormatJUnit:
+		return r.writeJUnit(w, thresholds)
+	}
+
+	return ValidFormat(format)
+}
+
+// subTarget gives the name of the subtarget of a result, the query for
+// digests
+func (r *Report) subTarget(res *Result) string {
+	if q, ok := r.DigestToQuery[res.SubTarget]; ok {
+		return q
+	}
+
+	return res.SubTarget
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func formatIntPtr(v *int) string {
+	if v == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*v)
+}
+
+// formatErrorReasons formats error reasons as <reason>=<count>, separated
+// by semicolons
+func formatErrorReasons(reasons []ErrorCount) string {
+	s := make([]string, 0, len(reasons))
+	for _, e := range reasons {
+		s = append(s, fmt.Sprintf("%s=%d", e.Reason, e.Count))
+	}
+
+	return strings.Join(s, ";")
+}
+
+// writeCSV writes a row per result, latencies are in milliseconds and sizes
+// in bytes
+func (r *Report) writeCSV(w io.Writer) error {
+	header := []string{"type", "target", "subtarget", "count", "rps", "errors", "deadline_exceeded",
+		"min", "max", "avg", "stddev"}
+	for _, p := range reportPercentiles {
+		header = append(header, "p"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	for _, p := range reportPercentiles {
+		header = append(header, "corrected_p"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	header = append(header, "failed_count", "failed_min", "failed_max", "failed_avg")
+	for _, p := range reportPercentiles {
+		header = append(header, "failed_p"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	header = append(header, "2xx", "3xx", "4xx", "5xx", "error_reasons",
+		"request_bytes", "response_bytes", "request_bytes_per_sec", "response_bytes_per_sec", "avg_request_size", "avg_response_size")
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for i := range r.Results {
+		res := &r.Results[i]
+		h := res.Histogram
+		row := []string{res.Type, res.Target, r.subTarget(res), strconv.FormatInt(h.Count, 10), formatFloat(res.AvgRPS),
+			formatIntPtr(res.Errors), "", formatFloat(h.Min), formatFloat(h.Max), formatFloat(h.Avg), formatFloat(h.StdDev)}
+		if res.Type == string(GrpcTrace) {
+			row[6] = formatIntPtr(res.Errors2)
+		}
+
+		for _, p := range reportPercentiles {
+			row = append(row, formatFloat(percentileValue(h.Percentiles, p)))
+		}
+		for _, p := range reportPercentiles {
+			if res.Corrected == nil {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, formatFloat(percentileValue(res.Corrected.Percentiles, p)))
+		}
+
+		if f := res.Failed; f != nil {
+			row = append(row, strconv.FormatInt(f.Count, 10), formatFloat(f.Min), formatFloat(f.Max), formatFloat(f.Avg))
+			for _, p := range reportPercentiles {
+				row = append(row, formatFloat(percentileValue(f.Percentiles, p)))
+			}
+		} else {
+			row = append(row, make([]string, 4+len(reportPercentiles))...)
+		}
+
+		row = append(row, formatIntPtr(res.Status2xx), formatIntPtr(res.Status3xx), formatIntPtr(res.Status4xx), formatIntPtr(res.Status5xx),
+			formatErrorReasons(res.ErrorReasons))
+
+		if b := res.Bytes; b != nil {
+			row = append(row, strconv.FormatInt(b.RequestBytes, 10), strconv.FormatInt(b.ResponseBytes, 10), formatFloat(b.RequestRate),
+				formatFloat(b.ResponseRate), formatFloat(b.RequestSize.Avg), formatFloat(b.ResponseSize.Avg))
+		} else {
+			row = append(row, make([]string, 6)...)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes a testcase per result (classname type.target, named
+// after the subtarget), failed if the result breaches any of the thresholds
+func (r *Report) writeJUnit(w io.Writer, thresholds []Threshold) error {
+	duration := r.EndTime.Sub(r.StartTime)
+	if d, err := time.ParseDuration(r.Duration); err == nil && d > duration {
+		duration = d
+	}
+
+	suite := junitTestSuite{
+		Name:      "lg " + r.Id,
+		Time:      formatFloat(duration.Seconds()),
+		Timestamp: r.StartTime.Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{"requestrate", strconv.Itoa(r.Requestrate)},
+			{"concurrency", strconv.Itoa(r.Concurrency)},
+			{"duration", r.Duration},
+		},
+	}
+
+	for i := range r.Results {
+		res := &r.Results[i]
+		name := r.subTarget(res)
+		if name == "" {
+			name = res.Target
+		}
+
+		tc := junitTestCase{
+			Name:      name,
+			ClassName: res.Type + "." + res.Target,
+			SystemOut: fmt.Sprintf("count=%d rps=%.2f errors=%s avg=%sms p99=%sms", res.Histogram.Count, res.AvgRPS,
+				formatIntPtr(res.Errors), FormatLatency(res.Histogram.Avg), FormatLatency(percentileValue(res.Histogram.Percentiles, 99))),
+		}
+
+		if b := breached(res, thresholds); len(b) > 0 {
+			tc.Failure = &junitFailure{
+				Message: "threshold breached: " + strings.Join(b, ", "),
+				Type:    "threshold",
+				Text:    strings.Join(b, "\n"),
+			}
+			suite.Failures++
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+
+	suites := junitTestSuites{
+		Name:     "lg",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// breached gives the thresholds the result breaches, with the observed
+// values
+func breached(res *Result, thresholds []Threshold) []string {
+	b := []string{}
+	for _, t := range thresholds {
+		if v, ok := t.Check(res); !ok {
+			b = append(b, fmt.Sprintf("%s (observed %s)", t, t.FormatValue(v)))
+		}
+	}
+
+	return b
+}
+
+// Breaches gives the thresholds breached by each result, empty if all of
+// them are met
+func (r *Report) Breaches(thresholds []Threshold) []string {
+	breaches := []string{}
+	for i := range r.Results {
+		res := &r.Results[i]
+		for _, b := range breached(res, thresholds) {
+			breaches = append(breaches, fmt.Sprintf("%s %s %s: %s", res.Type, res.Target, r.subTarget(res), b))
+		}
+	}
+
+	return breaches
+}
@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// histogramLog writes the latency histograms of the results in the
+// HdrHistogram interval log format (.hlog), an entry per result and interval
+// tagged <type>/<target>/<subtarget>, for the HdrHistogram tools
+// (HistogramLogAnalyzer, HistogramLogProcessor, hdr-plot...) to plot and
+// merge.
+//
+// Latencies are logged in nanoseconds, as the tools expect by default, from
+// histograms of their own so that they aren't rounded to microseconds.
+type histogramLog struct {
+	w        io.Writer
+	interval time.Duration
+	// Time the log is relative to, and start of the current interval
+	base  time.Time
+	start time.Time
+}
+
+// Log format version of the HdrHistogram tools
+const histogramLogVersion = "1.3"
+
+// SetHistogramLog makes the stats write the latency histograms of every
+// result for each interval of d (rounded to a second) to w, in the
+// HdrHistogram interval log format. It has to be called before Start.
+func (s *Stats) SetHistogramLog(w io.Writer, d time.Duration) {
+	if d < minInterval {
+		d = minInterval
+	}
+
+	s.hlog = &histogramLog{w: w, interval: d.Round(minInterval)}
+}
+
+// newLogHistogram gives a histogram for the log, with the range and precision
+// of the latency ones, in nanoseconds
+func newLogHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1, maxHistogramValue*int64(histogramUnit), histogramDigits)
+}
+
+// begin writes the header of the log, timestamps are relative to t
+func (l *histogramLog) begin(t time.Time) {
+	l.base = t
+	l.start = t
+
+	secs := float64(t.UnixNano()) / 1e9
+	header := fmt.Sprintf("#[Histogram log format version %s]\n", histogramLogVersion) +
+		"#[Latencies of lg results in nanoseconds, tagged <type>/<target>/<subtarget>]\n" +
+		fmt.Sprintf("#[StartTime: %.3f (seconds since epoch), %s]\n", secs, t.Format(time.RFC3339)) +
+		fmt.Sprintf("#[BaseTime: %.3f (seconds since epoch)]\n", secs) +
+		"\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n"
+
+	if _, err := io.WriteString(l.w, header); err != nil {
+		log.Warnf("Histogram log: %v", err)
+	}
+}
+
+// Characters tags can't have
+var unsafeTagChars = regexp.MustCompile(`[,\s]+`)
+
+func histogramLogTag(typ TraceType, key Key, subkey Subkey) string {
+	return unsafeTagChars.ReplaceAllString(fmt.Sprintf("%s/%s/%s", typ, key, subkey), "_")
+}
+
+// writeHistogramLog writes an entry for every result with requests since the
+// last time and resets their histograms
+func (s *Stats) writeHistogramLog(now time.Time) {
+	s.flush()
+
+	l := s.hlog
+	start := l.start.Sub(l.base).Seconds()
+	length := now.Sub(l.start).Seconds()
+
+	for typ, v1 := range s.metrics {
+		for key, v2 := range v1 {
+			for subkey, m := range v2 {
+				if m.hlog == nil || m.hlog.TotalCount() == 0 {
+					continue
+				}
+
+				payload, err := m.hlog.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+				if err != nil {
+					log.Warnf("Histogram log: %v", err)
+					continue
+				}
+
+				// Max is in milliseconds
+				_, err = fmt.Fprintf(l.w, "Tag=%s,%.3f,%.3f,%.3f,%s\n", histogramLogTag(typ, key, subkey),
+					start, length, float64(m.hlog.Max())/1e6, payload)
+				if err != nil {
+					log.Warnf("Histogram log: %v", err)
+				}
+				m.hlog.Reset()
+			}
+		}
+	}
+
+	l.start = now
+}
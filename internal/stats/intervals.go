@@ -0,0 +1,242 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Interval is a snapshot of a result over an interval of the run. Intervals
+// are aligned on multiples of the interval length (wall clock), so that the
+// ones of clients running together line up, the first and the last ones
+// might only cover part of it.
+type Interval struct {
+	Start       time.Time
+	Count       int64
+	Errors      int
+	RPS         float64
+	Min         float64
+	Max         float64
+	Avg         float64
+	Percentiles []Percentile
+	// Percentiles of the latency measured from the scheduled send time, if
+	// the requests were paced by the runner
+	Corrected []Percentile `json:",omitempty"`
+}
+
+const minInterval = time.Second
+
+// SetInterval makes the stats keep a snapshot of each result for every
+// interval of d (rounded to a second) in addition to the totals, 0 disables
+// them. It has to be called before Start.
+func (s *Stats) SetInterval(d time.Duration) {
+	if d > 0 && d < minInterval {
+		d = minInterval
+	}
+
+	s.interval = d.Round(minInterval)
+}
+
+// intervalSlot is the start of the interval t is in
+func (s *Stats) intervalSlot(t time.Time) time.Time {
+	return t.Truncate(s.interval)
+}
+
+// startInterval starts collecting a new interval at t
+func (s *Stats) startInterval(t time.Time) {
+	s.intervalStart = t
+	s.intervalEnd = s.intervalSlot(t).Add(s.interval)
+	s.intervalC = time.After(time.Until(s.intervalEnd))
+}
+
+// currentInterval gives the slot and the start of the interval in progress,
+// zero if there are no intervals
+func (s *Stats) currentInterval() (time.Time, time.Time) {
+	if s.interval == 0 || s.intervalStart.IsZero() {
+		return time.Time{}, time.Time{}
+	}
+
+	return s.intervalSlot(s.intervalStart), s.intervalStart
+}
+
+// snapshotIntervals ends the current interval of all the results
+func (s *Stats) snapshotIntervals(now time.Time) {
+	s.flush()
+	for _, v1 := range s.metrics {
+		for _, v2 := range v1 {
+			for _, m := range v2 {
+				if m.window == nil {
+					continue
+				}
+				m.intervals = append(m.intervals, m.window.interval(m, s.intervalSlot(s.intervalStart), now.Sub(s.intervalStart)))
+				m.window.reset(m.Errors)
+			}
+		}
+	}
+
+	s.startInterval(now)
+}
+
+// window collects the metrics of a result since it was last reset
+type window struct {
+	latency   *hdrhistogram.Histogram
+	corrected *hdrhistogram.Histogram
+	// Errors of the result when the window was reset
+	errors int
+}
+
+// newWindow gives a window, its histograms are created on the first record
+// as most results have no corrected latency
+func newWindow(errors int) *window {
+	return &window{errors: errors}
+}
+
+// record and recordCorrected do nothing on a nil window, as windows are
+// only there when enabled
+func (w *window) record(v int64) {
+	if w != nil {
+		if w.latency == nil {
+			w.latency = newHistogram()
+		}
+		w.latency.RecordValue(v)
+	}
+}
+
+func (w *window) recordCorrected(v int64) {
+	if w != nil {
+		if w.corrected == nil {
+			w.corrected = newHistogram()
+		}
+		w.corrected.RecordValue(v)
+	}
+}
+
+func (w *window) reset(errors int) {
+	if w.latency != nil {
+		w.latency.Reset()
+	}
+	if w.corrected != nil {
+		w.corrected.Reset()
+	}
+	w.errors = errors
+}
+
+// interval gives the snapshot of the metrics of m in the window, d long
+func (w *window) interval(m *Metrics, start time.Time, d time.Duration) Interval {
+	actualScale := scale
+	if m.Type == RawTrace {
+		actualScale = 1
+	}
+
+	i := Interval{
+		Start:  start,
+		Count:  totalCount(w.latency),
+		Errors: m.Errors - w.errors,
+	}
+
+	if d > 0 && m.Type != RawTrace {
+		i.RPS = float64(i.Count) / d.Seconds()
+	}
+
+	if i.Count > 0 {
+		i.Min = float64(w.latency.Min()) / actualScale
+		i.Max = float64(w.latency.Max()) / actualScale
+		i.Avg = w.latency.Mean() / actualScale
+		i.Percentiles = percentiles(w.latency, actualScale)
+	}
+
+	if totalCount(w.corrected) > 0 {
+		i.Corrected = percentiles(w.corrected, actualScale)
+	}
+
+	return i
+}
+
+// exportIntervals gives the intervals of the metrics, along with the one in
+// progress (started at start) if any
+func (m *Metrics) exportIntervals(slot time.Time, start time.Time) []Interval {
+	intervals := append([]Interval(nil), m.intervals...)
+	if d := time.Since(start); !start.IsZero() && d > 0 && m.window != nil {
+		// Imported results might have the same interval
+		intervals = mergeIntervals(intervals, []Interval{m.window.interval(m, slot, d)})
+	}
+
+	return intervals
+}
+
+func percentiles(h *hdrhistogram.Histogram, scale float64) []Percentile {
+	p := make([]Percentile, 0, len(reportPercentiles))
+	for _, q := range reportPercentiles {
+		p = append(p, Percentile{q, float64(h.ValueAtQuantile(q)) / scale})
+	}
+
+	return p
+}
+
+// mergeIntervals merges the intervals of results collected in parallel (ex:
+// by several clients). Counts, errors and rates add up, percentiles of an
+// interval are the highest of the results (an upper bound of the actual
+// ones).
+func mergeIntervals(a, b []Interval) []Interval {
+	// Sized for all the intervals, so that pointers to them stay valid
+	byStart := map[time.Time]*Interval{}
+	merged := make([]Interval, 0, len(a)+len(b))
+	merged = append(merged, a...)
+	for idx := range merged {
+		byStart[merged[idx].Start] = &merged[idx]
+	}
+
+	for _, i := range b {
+		m, ok := byStart[i.Start]
+		if !ok {
+			merged = append(merged, i)
+			continue
+		}
+
+		if i.Count > 0 {
+			if m.Count == 0 || i.Min < m.Min {
+				m.Min = i.Min
+			}
+			if i.Max > m.Max {
+				m.Max = i.Max
+			}
+			m.Avg = (m.Avg*float64(m.Count) + i.Avg*float64(i.Count)) / float64(m.Count+i.Count)
+		}
+		m.Count += i.Count
+		m.Errors += i.Errors
+		m.RPS += i.RPS
+		m.Percentiles = maxPercentiles(m.Percentiles, i.Percentiles)
+		m.Corrected = maxPercentiles(m.Corrected, i.Corrected)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Start.Before(merged[j].Start)
+	})
+
+	return merged
+}
+
+func maxPercentiles(a, b []Percentile) []Percentile {
+	if len(a) == 0 {
+		return b
+	}
+
+	a = append([]Percentile(nil), a...)
+	for _, p := range b {
+		found := false
+		for i := range a {
+			if a[i].Percentile == p.Percentile {
+				found = true
+				if p.Value > a[i].Value {
+					a[i].Value = p.Value
+				}
+			}
+		}
+		if !found {
+			a = append(a, p)
+		}
+	}
+
+	return a
+}
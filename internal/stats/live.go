@@ -0,0 +1,176 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// LiveReport is a line of the live report, for a result (see
+// Stats.SetLiveReport)
+type LiveReport struct {
+	Time      time.Time
+	Type      string
+	Target    string
+	SubTarget string
+	// Metrics since the previous line and since the start of the run (or
+	// the end of the warmup)
+	Interval Interval
+	Total    Interval
+}
+
+// SetLiveReport makes the stats write a line for every result, every d
+// (rounded to a second), to w while the run is going. format is text or
+// json (JSON lines). It has to be called before Start.
+func (s *Stats) SetLiveReport(d time.Duration, format string, w io.Writer) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid live report format %q, should be text or json", format)
+	}
+
+	if d > 0 && d < minInterval {
+		d = minInterval
+	}
+
+	s.liveInterval = d.Round(minInterval)
+	s.liveFormat = format
+	s.liveOut = w
+
+	return nil
+}
+
+// liveReport writes the live report lines of all the results
+func (s *Stats) liveReport(now time.Time) {
+	s.flush()
+
+	lines := []LiveReport{}
+	for typ, v1 := range s.metrics {
+		for key, v2 := range v1 {
+			for subkey, m := range v2 {
+				if m.live == nil {
+					continue
+				}
+
+				l := LiveReport{
+					Time:      now,
+					Type:      string(typ),
+					Target:    string(key),
+					SubTarget: string(subkey),
+					Interval:  m.live.interval(m, s.liveStart, now.Sub(s.liveStart)),
+					Total:     m.total(s.startTime, now.Sub(s.startTime)),
+				}
+				// The ones on the line, whatever the percentiles reported
+				l.Interval.Percentiles = m.withPercentiles(l.Interval.Percentiles, m.live.latency, 50, 99)
+				l.Total.Percentiles = m.withPercentiles(l.Total.Percentiles, m.latency, 99)
+				lines = append(lines, l)
+				m.live.reset(m.Errors)
+			}
+		}
+	}
+	s.liveStart = now
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.SubTarget < b.SubTarget
+	})
+
+	for _, l := range lines {
+		if s.liveFormat == "json" {
+			j, err := json.Marshal(l)
+			if err != nil {
+				log.Warnf("Live report: %v", err)
+				continue
+			}
+			fmt.Fprintf(s.liveOut, "%s\n", j)
+			continue
+		}
+
+		fmt.Fprintln(s.liveOut, l.String())
+	}
+}
+
+// total gives the metrics of the whole run, started at start and d long, as
+// an interval
+func (m *Metrics) total(start time.Time, d time.Duration) Interval {
+	w := window{latency: m.latency, corrected: m.corrected}
+	return w.interval(m, start, d)
+}
+
+// withPercentiles adds the qs percentiles of h missing from percentiles (see
+// SetPercentiles)
+func (m *Metrics) withPercentiles(percentiles []Percentile, h *hdrhistogram.Histogram, qs ...float64) []Percentile {
+	if totalCount(h) == 0 {
+		return percentiles
+	}
+
+	actualScale := scale
+	if m.Type == RawTrace {
+		actualScale = 1
+	}
+
+	for _, q := range qs {
+		if !slices.ContainsFunc(percentiles, func(p Percentile) bool { return p.Percentile == q }) {
+			percentiles = append(percentiles, Percentile{q, float64(h.ValueAtQuantile(q)) / actualScale})
+		}
+	}
+	sort.Slice(percentiles, func(i, j int) bool { return percentiles[i].Percentile < percentiles[j].Percentile })
+
+	return percentiles
+}
+
+func (l LiveReport) String() string {
+	unit := "ms"
+	if l.Type == string(RawTrace) {
+		unit = ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s", l.Time.Format("15:04:05"), l.Type, l.Target)
+	if l.SubTarget != "" {
+		fmt.Fprintf(&b, " %s", l.SubTarget)
+	}
+	fmt.Fprintf(&b, ": %.1f rps", l.Interval.RPS)
+	writePercentiles(&b, l.Interval.Percentiles, unit, 50, 99)
+	fmt.Fprintf(&b, ", %d errors | total: %d, %.1f rps", l.Interval.Errors, l.Total.Count, l.Total.RPS)
+	writePercentiles(&b, l.Total.Percentiles, unit, 99)
+	fmt.Fprintf(&b, ", %d errors", l.Total.Errors)
+
+	return b.String()
+}
+
+// writePercentiles writes the given percentiles, the ones that aren't there
+// are left out
+func writePercentiles(b *strings.Builder, percentiles []Percentile, unit string, qs ...float64) {
+	for _, q := range qs {
+		for _, p := range percentiles {
+			if p.Percentile == q {
+				if unit == "ms" {
+					fmt.Fprintf(b, ", p%v %s%s", q, FormatLatency(p.Value), unit)
+				} else {
+					fmt.Fprintf(b, ", p%v %.2f%s", q, p.Value, unit)
+				}
+			}
+		}
+	}
+}
+
+func percentileValue(percentiles []Percentile, q float64) float64 {
+	for _, p := range percentiles {
+		if p.Percentile == q {
+			return p.Value
+		}
+	}
+
+	return 0
+}
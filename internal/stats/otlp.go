@@ -0,0 +1,240 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// How long the last export is given when the stats are stopped
+const otlpShutdownTimeout = 10 * time.Second
+
+type OTLPOptions struct {
+	// Collector endpoint URL, ex: http://localhost:4317 (the scheme decides
+	// whether TLS is used)
+	Endpoint string
+	// grpc or http (protobuf)
+	Protocol string
+	// How often the metrics are pushed
+	Interval time.Duration
+	// Command being run, a resource attribute along with the run id and
+	// the host
+	Command string
+}
+
+func NewOTLPOptions() *OTLPOptions {
+	return &OTLPOptions{
+		Protocol: "grpc",
+		Interval: 10 * time.Second,
+	}
+}
+
+// otlp records the metrics to OpenTelemetry instruments as they come, for
+// them to be pushed to the collector
+type otlp struct {
+	options   OTLPOptions
+	id        string
+	exporter  *otlpExporter
+	provider  *sdkmetric.MeterProvider
+	requests  metric.Int64Counter
+	errors    metric.Int64Counter
+	deadline  metric.Int64Counter
+	responses metric.Int64Counter
+	latency   metric.Float64Histogram
+	corrected metric.Float64Histogram
+	raw       metric.Float64Histogram
+	workers   metric.Int64Gauge
+	// Attributes of each result
+	attrs map[TraceType]map[Key]map[Subkey]attribute.Set
+}
+
+// otlpExporter can drop what is left to push, for the instruments replaced
+// when the metrics are reset
+type otlpExporter struct {
+	sdkmetric.Exporter
+	discard atomic.Bool
+}
+
+func (e *otlpExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if e.discard.Load() {
+		return nil
+	}
+	return e.Exporter.Export(ctx, rm)
+}
+
+// SetOTLP makes the stats push the metrics, as they are recorded, to an
+// OpenTelemetry collector over OTLP. Latencies are sent as exponential
+// histograms. It has to be called before Start.
+func (s *Stats) SetOTLP(o OTLPOptions) error {
+	ot, err := newOTLP(o, s.id)
+	if err != nil {
+		return err
+	}
+
+	s.otlp = ot
+	return nil
+}
+
+func newOTLP(o OTLPOptions, id string) (*otlp, error) {
+	var exporter sdkmetric.Exporter
+	var err error
+	ctx := context.Background()
+	switch o.Protocol {
+	case "grpc":
+		exporter, err = otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(o.Endpoint))
+	case "http":
+		exporter, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(o.Endpoint))
+	default:
+		return nil, fmt.Errorf("invalid OTLP protocol %q, should be grpc or http", o.Protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("OTLP exporter: %v", err)
+	}
+	e := &otlpExporter{Exporter: exporter}
+
+	host, _ := os.Hostname()
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "lg"),
+		attribute.String("lg.run.id", id),
+		attribute.String("lg.command", o.Command),
+		attribute.String("host.name", host),
+	)
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(e, sdkmetric.WithInterval(o.Interval))),
+		sdkmetric.WithView(sdkmetric.NewView(
+			sdkmetric.Instrument{Kind: sdkmetric.InstrumentKindHistogram},
+			sdkmetric.Stream{Aggregation: sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}},
+		)),
+	)
+
+	meter := provider.Meter("github.com/freshworks/load-generator")
+	ot := &otlp{options: o, id: id, exporter: e, provider: provider, attrs: map[TraceType]map[Key]map[Subkey]attribute.Set{}}
+	errs := []error{}
+	newCounter := func(name, desc string) metric.Int64Counter {
+		c, err := meter.Int64Counter(name, metric.WithDescription(desc), metric.WithUnit("{request}"))
+		errs = append(errs, err)
+		return c
+	}
+	newHistogram := func(name, desc, unit string) metric.Float64Histogram {
+		h, err := meter.Float64Histogram(name, metric.WithDescription(desc), metric.WithUnit(unit))
+		errs = append(errs, err)
+		return h
+	}
+
+	ot.requests = newCounter("lg.requests", "Requests made")
+	ot.errors = newCounter("lg.errors", "Requests that failed")
+	ot.deadline = newCounter("lg.deadline_exceeded", "gRPC requests that failed with deadline exceeded")
+	ot.responses = newCounter("lg.http.responses", "HTTP responses by status class")
+	ot.latency = newHistogram("lg.request.duration", "Request latency", "s")
+	ot.corrected = newHistogram("lg.request.corrected_duration", "Request latency from the scheduled send time, corrected for coordinated omission", "s")
+	ot.raw = newHistogram("lg.raw.value", "Raw values recorded by scripts", "1")
+	ot.workers, err = meter.Int64Gauge("lg.workers", metric.WithDescription("Workers generating load"), metric.WithUnit("{worker}"))
+	errs = append(errs, err)
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("OTLP instruments: %v", err)
+		}
+	}
+
+	return ot, nil
+}
+
+// restart returns new instruments, their cumulative streams starting now, and
+// drops what the current ones haven't pushed yet. The metrics are reset this
+// way (ex: after the warmup) for the collector to get what the report shows.
+func (o *otlp) restart() *otlp {
+	n, err := newOTLP(o.options, o.id)
+	if err != nil {
+		log.Warnf("OTLP: %v", err)
+		return o
+	}
+
+	o.exporter.discard.Store(true)
+	go o.shutdown()
+	return n
+}
+
+func (o *otlp) attributes(t *TraceInfo) attribute.Set {
+	m1, ok := o.attrs[t.Type]
+	if !ok {
+		m1 = map[Key]map[Subkey]attribute.Set{}
+		o.attrs[t.Type] = m1
+	}
+
+	m2, ok := m1[Key(t.Key)]
+	if !ok {
+		m2 = map[Subkey]attribute.Set{}
+		m1[Key(t.Key)] = m2
+	}
+
+	set, ok := m2[Subkey(t.Subkey)]
+	if !ok {
+		set = attribute.NewSet(
+			attribute.String("type", string(t.Type)),
+			attribute.String("target", t.Key),
+			attribute.String("subtarget", t.Subkey),
+		)
+		m2[Subkey(t.Subkey)] = set
+	}
+
+	return set
+}
+
+// record records a metric, the same way MetricsMap.update does
+func (o *otlp) record(t *TraceInfo) {
+	ctx := context.Background()
+	set := o.attributes(t)
+	attrs := metric.WithAttributeSet(set)
+
+	if t.Type == RawTrace {
+		if t.Total != 0 {
+			o.raw.Record(ctx, float64(t.Total), attrs)
+		}
+		return
+	}
+
+	if t.Type == HttpTrace && t.Status >= 200 {
+		class := fmt.Sprintf("%dxx", min(t.Status/100, 5))
+		o.responses.Add(ctx, 1, metric.WithAttributeSet(set), metric.WithAttributes(attribute.String("class", class)))
+	}
+	if t.Type == GrpcTrace && t.DeadlineExceeded {
+		o.deadline.Add(ctx, 1, attrs)
+	}
+	if t.Error {
+		o.errors.Add(ctx, 1, attrs)
+	}
+
+	if t.Total != 0 {
+		o.requests.Add(ctx, 1, attrs)
+		o.latency.Record(ctx, t.Total.Seconds(), attrs)
+	}
+	if t.corrected != 0 {
+		o.corrected.Record(ctx, t.corrected.Seconds(), attrs)
+	}
+}
+
+func (o *otlp) recordWorkers(n int) {
+	o.workers.Record(context.Background(), int64(n))
+}
+
+// shutdown pushes the last metrics and stops the exporter
+func (o *otlp) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+	defer cancel()
+
+	if err := o.provider.Shutdown(ctx); err != nil {
+		log.Warnf("OTLP export: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package stats
+
+import (
+	"net/http"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Upper bounds (seconds) of the buckets of the latency histograms exposed to
+// Prometheus
+var prometheusBuckets = []float64{
+	0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60,
+}
+
+var (
+	promLabels = []string{"type", "target", "subtarget"}
+
+	promRequests = prometheus.NewDesc("lg_requests_total",
+		"Requests made", promLabels, nil)
+	promErrors = prometheus.NewDesc("lg_errors_total",
+		"Requests that failed", promLabels, nil)
+	promDeadlineExceeded = prometheus.NewDesc("lg_deadline_exceeded_total",
+		"gRPC requests that failed with deadline exceeded", promLabels, nil)
+	promResponses = prometheus.NewDesc("lg_http_responses_total",
+		"HTTP responses by status class", append(promLabels, "class"), nil)
+	promLatency = prometheus.NewDesc("lg_request_duration_seconds",
+		"Request latency", promLabels, nil)
+	promCorrected = prometheus.NewDesc("lg_request_corrected_duration_seconds",
+		"Request latency from the scheduled send time, corrected for coordinated omission", promLabels, nil)
+	promRawValues = prometheus.NewDesc("lg_raw_values",
+		"Raw values recorded by scripts", promLabels, nil)
+	promWorkers = prometheus.NewDesc("lg_workers",
+		"Workers generating load", nil, nil)
+)
+
+// PrometheusHandler serves the metrics collected so far in the Prometheus
+// exposition format, to be scraped while the run is going
+func (s *Stats) PrometheusHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&promCollector{s})
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+type promCollector struct {
+	stats *Stats
+}
+
+// Describe sends nothing, which makes this an unchecked collector: the
+// metrics depend on the targets seen so far
+func (c *promCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (c *promCollector) Collect(ch chan<- prometheus.Metric) {
+	report := c.stats.Export()
+
+	if n := len(report.Workers); n > 0 {
+		ch <- prometheus.MustNewConstMetric(promWorkers, prometheus.GaugeValue, float64(report.Workers[n-1].Workers))
+	}
+
+	for _, r := range report.Results {
+		labels := []string{r.Type, r.Target, r.SubTarget}
+
+		if r.Type == string(RawTrace) {
+			if r.LatencySnapshot != nil {
+				h := hdrhistogram.Import(r.LatencySnapshot)
+				ch <- prometheus.MustNewConstSummary(promRawValues, uint64(h.TotalCount()), h.Mean()*float64(h.TotalCount()),
+					promQuantiles(h, 1), labels...)
+			}
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(promRequests, prometheus.CounterValue, float64(r.Histogram.Count), labels...)
+		if r.Errors != nil {
+			ch <- prometheus.MustNewConstMetric(promErrors, prometheus.CounterValue, float64(*r.Errors), labels...)
+		}
+		if r.Type == string(GrpcTrace) && r.Errors2 != nil {
+			ch <- prometheus.MustNewConstMetric(promDeadlineExceeded, prometheus.CounterValue, float64(*r.Errors2), labels...)
+		}
+
+		if r.Type == string(HttpTrace) {
+			for class, n := range map[string]*int{"2xx": r.Status2xx, "3xx": r.Status3xx, "4xx": r.Status4xx, "5xx": r.Status5xx} {
+				if n != nil {
+					ch <- prometheus.MustNewConstMetric(promResponses, prometheus.CounterValue, float64(*n), append(labels, class)...)
+				}
+			}
+		}
+
+		if r.LatencySnapshot != nil {
+			ch <- promHistogram(promLatency, hdrhistogram.Import(r.LatencySnapshot), labels)
+		}
+		if r.CorrectedSnapshot != nil {
+			ch <- promHistogram(promCorrected, hdrhistogram.Import(r.CorrectedSnapshot), labels)
+		}
+	}
+}
+
+// promHistogram converts a latency histogram (in microseconds) to a
+// Prometheus one (in seconds)
+func promHistogram(desc *prometheus.Desc, h *hdrhistogram.Histogram, labels []string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(prometheusBuckets))
+	for _, b := range prometheusBuckets {
+		buckets[b] = 0
+	}
+
+	for _, bar := range h.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+
+		v := float64(bar.To) / scale / 1000
+		for _, b := range prometheusBuckets {
+			if v <= b {
+				buckets[b] += uint64(bar.Count)
+			}
+		}
+	}
+
+	sum := h.Mean() * float64(h.TotalCount()) / scale / 1000
+	return prometheus.MustNewConstHistogram(desc, uint64(h.TotalCount()), sum, buckets, labels...)
+}
+
+func promQuantiles(h *hdrhistogram.Histogram, scale float64) map[float64]float64 {
+	quantiles := make(map[float64]float64, len(reportPercentiles))
+	for _, p := range reportPercentiles {
+		quantiles[p/100] = float64(h.ValueAtQuantile(p)) / scale
+	}
+
+	return quantiles
+}
@@ -0,0 +1,239 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Sink is an output the stats push the aggregates of every result to, every
+// sink interval (see Stats.SetSinks). Writes happen outside of the stats
+// collector, one at a time.
+type Sink interface {
+	Write(points []SinkPoint) error
+	Close() error
+}
+
+// SinkPoint is the aggregate of a result over a sink interval
+type SinkPoint struct {
+	Time      time.Time
+	Type      string
+	Target    string
+	SubTarget string
+	Interval
+}
+
+// Points waiting to be written, beyond which they are dropped so that a slow
+// sink doesn't hold up the stats
+const sinkQueue = 10
+
+// How long a sink is given to write the points
+const sinkTimeout = 10 * time.Second
+
+// SetSinks makes the stats push the aggregates of every result to the sinks
+// for each interval of d (rounded to a second). It has to be called before
+// Start.
+func (s *Stats) SetSinks(d time.Duration, sinks ...Sink) {
+	if d < minInterval {
+		d = minInterval
+	}
+
+	s.sinkInterval = d.Round(minInterval)
+	s.sinks = sinks
+}
+
+// startSinks starts writing to the sinks, until stopSinks is called
+func (s *Stats) startSinks() {
+	s.sinkC = make(chan []SinkPoint, sinkQueue)
+	s.sinkWg.Add(1)
+	go func() {
+		defer s.sinkWg.Done()
+		for points := range s.sinkC {
+			for _, sink := range s.sinks {
+				if err := sink.Write(points); err != nil {
+					log.Warnf("Sink: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// stopSinks writes the points left and closes the sinks
+func (s *Stats) stopSinks() {
+	close(s.sinkC)
+	s.sinkWg.Wait()
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			log.Warnf("Sink: %v", err)
+		}
+	}
+}
+
+// flushSinks hands the aggregates of all the results since the last time
+// to the sinks
+func (s *Stats) flushSinks(now time.Time) {
+	s.flush()
+
+	points := []SinkPoint{}
+	for typ, v1 := range s.metrics {
+		for key, v2 := range v1 {
+			for subkey, m := range v2 {
+				if m.sink == nil {
+					continue
+				}
+
+				points = append(points, SinkPoint{
+					Time:      now,
+					Type:      string(typ),
+					Target:    string(key),
+					SubTarget: string(subkey),
+					Interval:  m.sink.interval(m, s.sinkStart, now.Sub(s.sinkStart)),
+				})
+				m.sink.reset(m.Errors)
+			}
+		}
+	}
+	s.sinkStart = now
+
+	if len(points) == 0 {
+		return
+	}
+
+	select {
+	case s.sinkC <- points:
+	default:
+		log.Warnf("Sinks are falling behind, dropped the metrics of %v", now.Format(time.RFC3339))
+	}
+}
+
+// NewSink gives the sink for a URL: statsd://host:port (UDP),
+// graphite://host:port (plaintext protocol over TCP), or
+// influx://host:port/<path> (InfluxDB line protocol over HTTP, influxs for
+// HTTPS, ex: influx://localhost:8086/write?db=lg). name is the template of
+// the metric names (influx measurement), from the fields of SinkPoint, empty
+// for the default.
+func NewSink(rawurl string, name string) (Sink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink %q: %v", rawurl, err)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid sink %q, should be <statsd|graphite|influx|influxs>://host:port", rawurl)
+	}
+
+	switch u.Scheme {
+	case "statsd":
+		return newStatsdSink(u.Host, name)
+	case "graphite":
+		return newGraphiteSink(u.Host, name)
+	case "influx", "influxs":
+		return newInfluxSink(u, name)
+	default:
+		return nil, fmt.Errorf("invalid sink %q, unknown type %q (statsd, graphite, influx or influxs)", rawurl, u.Scheme)
+	}
+}
+
+// Default metric names of the sinks with dotted names
+const defaultSinkName = "lg.{{.Type}}.{{.Target}}.{{.SubTarget}}"
+
+// sinkName renders the metric names of points
+type sinkName struct {
+	tmpl *template.Template
+	// Applied to the fields before rendering
+	clean func(string) string
+}
+
+func newSinkName(name string, def string, clean func(string) string) (*sinkName, error) {
+	if name == "" {
+		name = def
+	}
+
+	t, err := template.New("name").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink name template %q: %v", name, err)
+	}
+
+	// Rendered once to catch unknown fields early
+	if err := t.Execute(&bytes.Buffer{}, SinkPoint{}); err != nil {
+		return nil, fmt.Errorf("invalid sink name template %q: %v", name, err)
+	}
+
+	return &sinkName{tmpl: t, clean: clean}, nil
+}
+
+func (n *sinkName) render(p SinkPoint) string {
+	p.Type = n.clean(p.Type)
+	p.Target = n.clean(p.Target)
+	p.SubTarget = n.clean(p.SubTarget)
+
+	var b strings.Builder
+	if err := n.tmpl.Execute(&b, p); err != nil {
+		log.Warnf("Sink name: %v", err)
+	}
+
+	return b.String()
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_\-]+`)
+
+// dottedName makes a field safe as a part of a dotted (Graphite, StatsD)
+// metric name
+func dottedName(s string) string {
+	return strings.Trim(unsafeNameChars.ReplaceAllString(s, "_"), "_")
+}
+
+// trimDots drops the empty parts of a dotted name, left by empty fields
+func trimDots(name string) string {
+	parts := strings.Split(name, ".")
+	kept := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+
+	return strings.Join(kept, ".")
+}
+
+// sinkValue is a value of a point, name being the suffix of the metric name
+// (influx field)
+type sinkValue struct {
+	name  string
+	value float64
+	count bool
+}
+
+// values gives the values of a point, latencies are in milliseconds
+func (p SinkPoint) values() []sinkValue {
+	v := []sinkValue{
+		{"count", float64(p.Count), true},
+		{"errors", float64(p.Errors), true},
+	}
+
+	if p.Type != string(RawTrace) {
+		v = append(v, sinkValue{"rps", p.RPS, false})
+	}
+
+	// No latency without requests, rather than zeros
+	if p.Count == 0 {
+		return v
+	}
+
+	v = append(v, sinkValue{"min", p.Min, false}, sinkValue{"max", p.Max, false}, sinkValue{"avg", p.Avg, false})
+	for _, q := range p.Percentiles {
+		name := "p" + strings.ReplaceAll(strconv.FormatFloat(q.Percentile, 'f', -1, 64), ".", "_")
+		v = append(v, sinkValue{name, q.Value, false})
+	}
+
+	return v
+}
+
+func formatSinkValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
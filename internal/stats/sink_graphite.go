@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+)
+
+// graphiteSink sends the values of the points with the Graphite plaintext
+// protocol, reconnecting on errors
+type graphiteSink struct {
+	addr string
+	conn net.Conn
+	name *sinkName
+}
+
+func newGraphiteSink(addr string, name string) (*graphiteSink, error) {
+	n, err := newSinkName(name, defaultSinkName, dottedName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &graphiteSink{addr: addr, name: n}, nil
+}
+
+func (s *graphiteSink) Write(points []SinkPoint) error {
+	var b bytes.Buffer
+	for _, p := range points {
+		name := trimDots(s.name.render(p))
+		for _, v := range p.values() {
+			fmt.Fprintf(&b, "%s.%s %s %d\n", name, v.name, formatSinkValue(v.value), p.Time.Unix())
+		}
+	}
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.addr, sinkTimeout)
+		if err != nil {
+			return fmt.Errorf("graphite sink: %v", err)
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(sinkTimeout))
+	if _, err := s.conn.Write(b.Bytes()); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("graphite sink: %v", err)
+	}
+
+	return nil
+}
+
+func (s *graphiteSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
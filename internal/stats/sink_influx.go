@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// influxSink writes the points with the InfluxDB line protocol, one line per
+// point with type, target and subtarget as tags. The INFLUX_TOKEN
+// environment variable is sent as the API token if set.
+type influxSink struct {
+	url    string
+	token  string
+	client *http.Client
+	name   *sinkName
+}
+
+func newInfluxSink(u *url.URL, name string) (*influxSink, error) {
+	n, err := newSinkName(name, "lg", func(s string) string { return s })
+	if err != nil {
+		return nil, err
+	}
+
+	w := *u
+	w.Scheme = "http"
+	if u.Scheme == "influxs" {
+		w.Scheme = "https"
+	}
+
+	return &influxSink{
+		url:    w.String(),
+		token:  os.Getenv("INFLUX_TOKEN"),
+		client: &http.Client{Timeout: sinkTimeout},
+		name:   n,
+	}, nil
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+func (s *influxSink) Write(points []SinkPoint) error {
+	var b bytes.Buffer
+	for _, p := range points {
+		b.WriteString(influxMeasurementEscaper.Replace(s.name.render(p)))
+		// Sorted by key, empty tags aren't allowed
+		for _, tag := range [][2]string{{"subtarget", p.SubTarget}, {"target", p.Target}, {"type", p.Type}} {
+			if tag[1] != "" {
+				fmt.Fprintf(&b, ",%s=%s", tag[0], influxTagEscaper.Replace(tag[1]))
+			}
+		}
+
+		for i, v := range p.values() {
+			sep := ","
+			if i == 0 {
+				sep = " "
+			}
+
+			if v.count {
+				fmt.Fprintf(&b, "%s%s=%di", sep, v.name, int64(v.value))
+			} else {
+				fmt.Fprintf(&b, "%s%s=%s", sep, v.name, formatSinkValue(v.value))
+			}
+		}
+		fmt.Fprintf(&b, " %d\n", p.Time.UnixNano())
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &b)
+	if err != nil {
+		return fmt.Errorf("influx sink: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("influx sink: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx sink: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func (s *influxSink) Close() error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// Keeps StatsD packets within the usual MTU
+const statsdPacketSize = 1432
+
+// statsdSink sends the values of the points as StatsD counters (count,
+// errors) and gauges (the rest) over UDP
+type statsdSink struct {
+	conn net.Conn
+	name *sinkName
+}
+
+func newStatsdSink(addr string, name string) (*statsdSink, error) {
+	n, err := newSinkName(name, defaultSinkName, dottedName)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd sink: %v", err)
+	}
+
+	return &statsdSink{conn: conn, name: n}, nil
+}
+
+func (s *statsdSink) Write(points []SinkPoint) error {
+	var packet bytes.Buffer
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := s.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+
+	for _, p := range points {
+		name := trimDots(s.name.render(p))
+		for _, v := range p.values() {
+			typ := "g"
+			if v.count {
+				typ = "c"
+			}
+
+			line := fmt.Sprintf("%s.%s:%s|%s", name, v.name, formatSinkValue(v.value), typ)
+			if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+				if err := send(); err != nil {
+					return fmt.Errorf("statsd sink: %v", err)
+				}
+			}
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+
+	if err := send(); err != nil {
+		return fmt.Errorf("statsd sink: %v", err)
+	}
+
+	return nil
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
@@ -3,6 +3,7 @@ package stats
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"sort"
 	"strconv"
@@ -17,11 +18,18 @@ import (
 )
 
 var (
-	// 5 mins (in usecs)
+	// Highest value the latency histograms track, 5 mins (in usecs) by
+	// default, their precision in significant digits and the unit of their
+	// values, the lowest latency they tell apart (see SetHistogram)
 	maxHistogramValue = int64(5 * 60 * 1000000)
+	histogramDigits   = 3
+	histogramUnit     = time.Microsecond
 	barChar           = "■"
 	log               *logrus.Entry
-	scale             = 1000.0
+	// Latency histogram values in a millisecond, latencies are shown in
+	// milliseconds with enough decimals for the unit
+	scale           = 1000.0
+	latencyDecimals = 2
 )
 
 type Key string
@@ -43,10 +51,37 @@ type Stats struct {
 	// This is where all the per request info is stored
 	metrics       MetricsMap
 	digestToQuery map[string]string
-	statsChan     chan *TraceInfo
-	statsWg       sync.WaitGroup
-	statsCmd      chan statsCmd
-	server        bool
+	stages        []Stage
+	budget        *Budget
+	abandoned     int
+	workers       []WorkerEvent
+	// Length of the intervals snapshots are taken for (0 if disabled), and
+	// bounds of the current one
+	interval      time.Duration
+	intervalStart time.Time
+	intervalEnd   time.Time
+	intervalC     <-chan time.Time
+	// Live report, every liveInterval (0 if disabled)
+	liveInterval time.Duration
+	liveFormat   string
+	liveOut      io.Writer
+	liveStart    time.Time
+	statsChan    chan *TraceInfo
+	statsWg      sync.WaitGroup
+	statsCmd     chan statsCmd
+	server       bool
+	// Prefix of the keys of the results recorded (see Scoped)
+	scope string
+	// OTLP export (nil if disabled)
+	otlp *otlp
+	// Sinks pushed to every sinkInterval (none if disabled)
+	sinks        []Sink
+	sinkInterval time.Duration
+	sinkStart    time.Time
+	sinkC        chan []SinkPoint
+	sinkWg       sync.WaitGroup
+	// HdrHistogram interval log (nil if disabled)
+	hlog *histogramLog
 }
 
 type statsCmd struct {
@@ -62,6 +97,10 @@ const (
 	statsCmdQuit                // Quit
 	statsCmdExport              // Export metrics report
 	statsCmdImport              // Import metrics report
+	statsCmdStage               // Record start of a load stage
+	statsCmdBudget              // Record outcome of the iteration budget
+	statsCmdAbandoned           // Record requests abandoned at stop
+	statsCmdWorkers             // Record change in the number of workers
 )
 
 type TraceType string
@@ -77,6 +116,7 @@ const (
 	SmtpTrace       TraceType = "smtp"
 	MongoTrace      TraceType = "mongo"
 	CustomTrace     TraceType = "custom"
+	UserTrace       TraceType = "user"
 	RawTrace        TraceType = "raw"
 )
 
@@ -88,17 +128,52 @@ type TraceInfo struct {
 	Status           int
 	Error            bool
 	DeadlineExceeded bool
+	// Class of the error if Error (ex: timeout, connection refused, a
+	// status code), failed requests are counted per reason
+	ErrorReason string
+	// Bytes sent and received (payload), for generators measuring them,
+	// which set Sized for the sizes to be recorded even when 0
+	RequestSize  int64
+	ResponseSize int64
+	Sized        bool
+	// Time at which the runner scheduled the request to be sent. If set,
+	// latency is also recorded from this time, which corrects for
+	// coordinated omission when the target can't keep up with the rate
+	Scheduled time.Time
+
+	corrected time.Duration
 }
 
 type Metrics struct {
-	Type      TraceType
-	latency   *hdrhistogram.Histogram
+	Type    TraceType
+	latency *hdrhistogram.Histogram
+	// Latency corrected for coordinated omission, and of the failed
+	// requests alone (nil until recorded)
+	corrected *hdrhistogram.Histogram
+	failed    *hdrhistogram.Histogram
 	Status5xx int
 	Status4xx int
 	Status3xx int
 	Status2xx int
 	Errors    int
 	Errors2   int
+	// Failed requests per reason
+	errorReasons map[string]int
+	// Bytes sent and received, and sizes per request (nil unless the
+	// generator measures them)
+	RequestBytes  int64
+	ResponseBytes int64
+	requestSize   *hdrhistogram.Histogram
+	responseSize  *hdrhistogram.Histogram
+	// Metrics of the current interval and snapshots of the previous ones,
+	// and metrics since the last live report (nil if disabled)
+	window    *window
+	intervals []Interval
+	live      *window
+	sink      *window
+	// Latency in nanoseconds since the last histogram log entry (nil if
+	// disabled)
+	hlog *hdrhistogram.Histogram
 	// For RPS calculation
 	rps            *hdrhistogram.Histogram
 	lastReftime    time.Time
@@ -112,11 +187,79 @@ type Report struct {
 	Duration      string
 	StartTime     time.Time
 	EndTime       time.Time
-	NumWorkers    *int `json:",omitempty"`
+	NumWorkers    *int          `json:",omitempty"`
+	Stages        []Stage       `json:",omitempty"`
+	Budget        *Budget       `json:",omitempty"`
+	Abandoned     *int          `json:",omitempty"`
+	Workers       []WorkerEvent `json:",omitempty"`
 	Results       []Result
 	DigestToQuery map[string]string `json:",omitempty"`
 }
 
+// Stage is the boundary of a stage in a staged load profile, during which
+// the rate was ramped from From to Target
+type Stage struct {
+	Start    time.Time
+	Duration string
+	From     int
+	Target   int
+}
+
+// Worker events
+const (
+	WorkersStarted    = "started"
+	WorkersDone       = "done"
+	WorkersInitFailed = "init failed"
+	WorkersTickFailed = "tick failed"
+	WorkersRestarted  = "restarted"
+	WorkersScaledUp   = "scaled up"
+	WorkersScaledDown = "scaled down"
+)
+
+// WorkerEvent is a change in the number of live workers (ones generating
+// load), with what caused it
+type WorkerEvent struct {
+	Time    time.Time
+	Workers int
+	Event   string
+}
+
+// Budget is the outcome of a run limited to a number of iterations (ticks),
+// either in total or per worker
+type Budget struct {
+	Iterations int `json:",omitempty"`
+	PerWorker  int `json:",omitempty"`
+	Done       int
+	Met        bool
+	// Why the run ended before the budget was met
+	Reason string `json:",omitempty"`
+}
+
+func (b *Budget) merge(o *Budget) {
+	b.Iterations += o.Iterations
+	b.PerWorker = o.PerWorker
+	b.Done += o.Done
+	b.Met = b.Met && o.Met
+	if b.Reason == "" {
+		b.Reason = o.Reason
+	}
+}
+
+func (b *Budget) String() string {
+	var budget string
+	if b.Iterations > 0 {
+		budget = fmt.Sprintf("%d of %d iterations done", b.Done, b.Iterations)
+	} else {
+		budget = fmt.Sprintf("%d iterations done (%d per worker)", b.Done, b.PerWorker)
+	}
+
+	if b.Met {
+		return "Iteration budget met: " + budget
+	}
+
+	return fmt.Sprintf("Iteration budget not met: %s, ended early: %s", budget, b.Reason)
+}
+
 type Result struct {
 	Type            string
 	Target          string
@@ -129,7 +272,21 @@ type Result struct {
 	Status2xx       *int                   `json:",omitempty"`
 	Errors          *int                   `json:",omitempty"`
 	Errors2         *int                   `json:",omitempty"`
+	ErrorReasons    []ErrorCount           `json:",omitempty"`
 	LatencySnapshot *hdrhistogram.Snapshot `json:"-"`
+	// Latency measured from the scheduled send time, only present when
+	// the requests were paced by the runner
+	Corrected         *HistogramData         `json:",omitempty"`
+	CorrectedSnapshot *hdrhistogram.Snapshot `json:"-"`
+	// Latency of the failed requests alone, only present if any was
+	// measured
+	Failed         *HistogramData         `json:",omitempty"`
+	FailedSnapshot *hdrhistogram.Snapshot `json:"-"`
+	// Bytes sent and received, only present if the generator measures
+	// them
+	Bytes *ByteData `json:",omitempty"`
+	// Snapshots over time, if enabled (see Stats.SetInterval)
+	Intervals []Interval `json:",omitempty"`
 }
 
 type HistogramData struct {
@@ -192,13 +349,24 @@ func newSubkeyMap() map[Subkey]*Metrics {
 
 func newMetrics() *Metrics {
 	return &Metrics{
-		latency: hdrhistogram.New(1, maxHistogramValue, 3),
+		latency: newHistogram(),
 		rps:     hdrhistogram.New(1, int64(10000000), 3),
 	}
 }
 
 func (s *Stats) Start() {
 	s.startTime = time.Now()
+	s.liveStart = s.startTime
+	s.sinkStart = s.startTime
+	if len(s.sinks) > 0 && !s.server {
+		s.startSinks()
+	}
+	if s.interval > 0 && !s.server {
+		s.startInterval(s.startTime)
+	}
+	if s.hlog != nil && !s.server {
+		s.hlog.begin(s.startTime)
+	}
 	s.statsWg.Add(1)
 	go func() {
 		defer s.statsWg.Done()
@@ -211,6 +379,13 @@ func (s *Stats) Stop() {
 	s.statsCmd <- statsCmd{statsCmdQuit, nil, done}
 	<-done
 	s.statsWg.Wait()
+
+	if s.sinkC != nil {
+		s.stopSinks()
+	}
+	if s.otlp != nil {
+		s.otlp.shutdown()
+	}
 }
 
 func (s *Stats) Reset() {
@@ -244,6 +419,46 @@ func (s *Stats) Import(report *Report) {
 	<-done
 }
 
+// Scoped gives stats recording the results to s, with their keys prefixed by
+// scope ("<scope>/<key>"), to tell apart the load generators run together
+// (ex: scenarios) hitting the same targets. Only the Record methods are to be
+// used on it.
+func (s *Stats) Scoped(scope string) *Stats {
+	return &Stats{
+		id:        s.id,
+		statsChan: s.statsChan,
+		statsCmd:  s.statsCmd,
+		scope:     scope,
+	}
+}
+
+// RecordBudget records the iteration budget of a run, the ones of the runs
+// sharing the stats add up
+func (s *Stats) RecordBudget(budget Budget) {
+	done := make(chan interface{})
+	s.statsCmd <- statsCmd{cmd: statsCmdBudget, arg: budget, done: done}
+	<-done
+}
+
+// RecordWorkers records the number of live workers after the given event
+func (s *Stats) RecordWorkers(n int, event string) {
+	done := make(chan interface{})
+	s.statsCmd <- statsCmd{cmd: statsCmdWorkers, arg: WorkerEvent{Time: time.Now(), Workers: n, Event: event}, done: done}
+	<-done
+}
+
+func (s *Stats) RecordAbandoned(n int) {
+	done := make(chan interface{})
+	s.statsCmd <- statsCmd{cmd: statsCmdAbandoned, arg: n, done: done}
+	<-done
+}
+
+func (s *Stats) RecordStage(stage Stage) {
+	done := make(chan interface{})
+	s.statsCmd <- statsCmd{statsCmdStage, stage, done}
+	<-done
+}
+
 func (mm MetricsMap) update(t *TraceInfo) {
 	m := mm.getMetrics(t.Type, Key(t.Key), Subkey(t.Subkey))
 
@@ -267,14 +482,27 @@ func (mm MetricsMap) update(t *TraceInfo) {
 
 	if t.Error {
 		m.Errors++
+		m.addErrorReasons(t.ErrorReason, 1)
+	}
+
+	if t.Sized {
+		m.AddSizes(t.RequestSize, t.ResponseSize)
 	}
 
 	if t.Total != 0 {
 		if t.Type != RawTrace {
-			m.Add(int64(t.Total / time.Microsecond))
+			m.Add(int64(t.Total / histogramUnit))
 		} else {
 			m.Add(int64(t.Total))
 		}
+
+		if t.Error && t.Type != RawTrace {
+			m.AddFailed(int64(t.Total / histogramUnit))
+		}
+	}
+
+	if t.corrected != 0 {
+		m.AddCorrected(int64(t.corrected / histogramUnit))
 	}
 }
 
@@ -288,7 +516,9 @@ func (mm MetricsMap) updateRPS() {
 	}
 }
 
-func (mm MetricsMap) export() []Result {
+// export gives the results, with their intervals (the current one started
+// at intervalStart, zero if none), collected over elapsed
+func (mm MetricsMap) export(intervalSlot, intervalStart time.Time, elapsed time.Duration) []Result {
 	results := []Result{}
 	for _, m := range mm {
 		for key, v := range m {
@@ -299,32 +529,33 @@ func (mm MetricsMap) export() []Result {
 				}
 
 				r := Result{
-					Type:      string(m.Type),
-					Target:    string(key),
-					SubTarget: string(subkey),
-					AvgRPS:    m.rps.Mean(),
-					Histogram: HistogramData{
-						Min:    float64(m.latency.Min()) / actualScale,
-						Max:    float64(m.latency.Max()) / actualScale,
-						Avg:    m.latency.Mean() / actualScale,
-						StdDev: m.latency.StdDev() / actualScale,
-						//Sum:    m.latency.Sum(),
-						Count: m.latency.TotalCount(),
-						Data:  getHistogramBuckets(m.latency, actualScale),
-						Percentiles: []Percentile{
-							Percentile{50.0, float64(m.latency.ValueAtQuantile(50)) / actualScale},
-							Percentile{75.0, float64(m.latency.ValueAtQuantile(75)) / actualScale},
-							Percentile{90.0, float64(m.latency.ValueAtQuantile(90)) / actualScale},
-							Percentile{95.0, float64(m.latency.ValueAtQuantile(95)) / actualScale},
-							Percentile{99.0, float64(m.latency.ValueAtQuantile(99)) / actualScale},
-							Percentile{99.99, float64(m.latency.ValueAtQuantile(99.99)) / actualScale},
-						},
-					},
+					Type:            string(m.Type),
+					Target:          string(key),
+					SubTarget:       string(subkey),
+					AvgRPS:          m.rps.Mean(),
+					Histogram:       histogramData(m.latency, actualScale),
 					Errors:          intPtr(m.Errors),
 					Errors2:         intPtr(m.Errors2),
+					ErrorReasons:    m.exportErrorReasons(),
 					LatencySnapshot: m.latency.Export(),
 				}
 
+				r.Intervals = m.exportIntervals(intervalSlot, intervalStart)
+
+				if totalCount(m.corrected) > 0 {
+					h := histogramData(m.corrected, actualScale)
+					r.Corrected = &h
+					r.CorrectedSnapshot = m.corrected.Export()
+				}
+
+				if totalCount(m.failed) > 0 {
+					h := histogramData(m.failed, actualScale)
+					r.Failed = &h
+					r.FailedSnapshot = m.failed.Export()
+				}
+
+				r.Bytes = m.exportBytes(elapsed)
+
 				if m.Type == HttpTrace {
 					r.Status2xx = intPtr(m.Status2xx)
 					r.Status3xx = intPtr(m.Status3xx)
@@ -358,6 +589,103 @@ func (mm MetricsMap) export() []Result {
 	return results
 }
 
+func histogramData(h *hdrhistogram.Histogram, scale float64) HistogramData {
+	return HistogramData{
+		Min:    float64(h.Min()) / scale,
+		Max:    float64(h.Max()) / scale,
+		Avg:    h.Mean() / scale,
+		StdDev: h.StdDev() / scale,
+		//Sum:    h.Sum(),
+		Count:       h.TotalCount(),
+		Data:        getHistogramBuckets(h, scale),
+		Percentiles: percentiles(h, scale),
+	}
+}
+
+// Percentiles shown and exported (see SetPercentiles)
+var reportPercentiles = []float64{50, 75, 90, 95, 99, 99.99}
+
+// ParsePercentiles parses comma separated percentiles, ex: "50,90,99,99.9"
+func ParsePercentiles(s string) ([]float64, error) {
+	percentiles := []float64{}
+	for _, v := range strings.Split(s, ",") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+
+		p, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(v), "p"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q, should be a number in (0, 100]", v)
+		}
+		percentiles = append(percentiles, p)
+	}
+
+	if len(percentiles) == 0 {
+		return nil, fmt.Errorf("no percentiles in %q", s)
+	}
+
+	sort.Float64s(percentiles)
+	return percentiles, nil
+}
+
+// SetPercentiles sets the percentiles of the latency shown in the tables and
+// exported in the reports. It has to be called before the stats are created.
+func SetPercentiles(percentiles []float64) {
+	reportPercentiles = percentiles
+}
+
+// SetHistogram sets the highest latency the histograms can track (higher
+// ones are dropped with a warning), their precision, in significant digits
+// (1 to 5, more takes more memory), and the unit latencies are tracked in,
+// shorter ones being recorded as 0 (ex: time.Nanosecond for sub-microsecond
+// requests, at the cost of a little more memory). It has to be called before
+// the stats are created.
+func SetHistogram(max time.Duration, digits int, unit time.Duration) error {
+	if max < time.Millisecond {
+		return fmt.Errorf("invalid histogram max %v, should be at least 1ms", max)
+	}
+
+	if digits < 1 || digits > 5 {
+		return fmt.Errorf("invalid histogram precision %d, should be 1 to 5 significant digits", digits)
+	}
+
+	if unit <= 0 || time.Millisecond%unit != 0 {
+		return fmt.Errorf("invalid histogram unit %v, should divide 1ms (ex: 1ns, 1us)", unit)
+	}
+
+	maxHistogramValue = int64(max / unit)
+	histogramDigits = digits
+	histogramUnit = unit
+	scale = float64(time.Millisecond / unit)
+	// 2 for microseconds, 5 for nanoseconds
+	latencyDecimals = len(strconv.FormatInt(int64(time.Millisecond/unit), 10)) - 2
+	if latencyDecimals < 0 {
+		latencyDecimals = 0
+	}
+
+	return nil
+}
+
+// FormatLatency formats a latency in milliseconds with the decimals the
+// histogram unit gives (see SetHistogram)
+func FormatLatency(v float64) string {
+	return strconv.FormatFloat(v, 'f', latencyDecimals, 64)
+}
+
+func newHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1, maxHistogramValue, histogramDigits)
+}
+
+// totalCount gives the number of values of a histogram created on the first
+// record, 0 if none yet
+func totalCount(h *hdrhistogram.Histogram) int64 {
+	if h == nil {
+		return 0
+	}
+
+	return h.TotalCount()
+}
+
 func (mm MetricsMap) importReport(report *Report) {
 	for _, r := range report.Results {
 		t := TraceType(r.Type)
@@ -387,11 +715,43 @@ func (mm MetricsMap) importReport(report *Report) {
 			m.Errors2 += *r.Errors2
 		}
 
+		for _, e := range r.ErrorReasons {
+			m.addErrorReasons(e.Reason, e.Count)
+		}
+
 		d := m.latency.Merge(hdrhistogram.Import(r.LatencySnapshot))
 		if d != 0 {
 			logrus.Warnf("Dropped latency metrics: %v", d)
 		}
 
+		if r.CorrectedSnapshot != nil {
+			if m.corrected == nil {
+				m.corrected = newHistogram()
+			}
+			d := m.corrected.Merge(hdrhistogram.Import(r.CorrectedSnapshot))
+			if d != 0 {
+				logrus.Warnf("Dropped corrected latency metrics: %v", d)
+			}
+		}
+
+		if r.FailedSnapshot != nil {
+			if m.failed == nil {
+				m.failed = newHistogram()
+			}
+			d := m.failed.Merge(hdrhistogram.Import(r.FailedSnapshot))
+			if d != 0 {
+				logrus.Warnf("Dropped failed latency metrics: %v", d)
+			}
+		}
+
+		if r.Bytes != nil {
+			m.importBytes(r.Bytes)
+		}
+
+		if len(r.Intervals) > 0 {
+			m.intervals = mergeIntervals(m.intervals, r.Intervals)
+		}
+
 		// Don't merge, add the rps. This assumes all clients run in
 		// parallel and send the results
 		//
@@ -405,7 +765,7 @@ func (mm MetricsMap) importReport(report *Report) {
 	}
 }
 
-func (mm MetricsMap) print() string {
+func (mm MetricsMap) print(elapsed time.Duration) string {
 	var out strings.Builder
 
 	for typ, v1 := range mm {
@@ -482,6 +842,10 @@ func (mm MetricsMap) print() string {
 				name = "Custom Metrics"
 				subKeyDisplayName = "Key"
 
+			case UserTrace:
+				name = "Virtual User Metrics"
+				subKeyDisplayName = "User"
+
 			case SmtpTrace:
 				name = "SMTP Metrics"
 				subKeyDisplayName = "Key"
@@ -499,8 +863,7 @@ func (mm MetricsMap) print() string {
 			fmt.Fprintf(&out, "\n%v:\n", name)
 			fmt.Fprintf(&out, "\n%s:\n", v2.key)
 
-			hdrs := []string{subKeyDisplayName, "Avg", "StdDev", "Min",
-				"Max", "p50", "p95", "p99", "p99.99", "Total"}
+			hdrs := append([]string{subKeyDisplayName}, latencyHeaders()...)
 			if typ != RawTrace {
 				hdrs = append(hdrs, []string{"AvgRPS", "Errors"}...)
 			}
@@ -514,18 +877,7 @@ func (mm MetricsMap) print() string {
 			table.Header(hdrInterfaces...)
 
 			for _, u := range resps {
-				records := []string{
-					string(u.subkey),
-					strconv.FormatFloat(u.resp.latency.Mean()/actualScale, 'f', 2, 64),
-					strconv.FormatFloat(u.resp.latency.StdDev()/actualScale, 'f', 2, 64),
-					strconv.FormatFloat(float64(u.resp.latency.Min())/actualScale, 'f', 2, 64),
-					strconv.FormatFloat(float64(u.resp.latency.Max())/actualScale, 'f', 2, 64),
-					strconv.FormatFloat(float64(u.resp.latency.ValueAtQuantile(50))/actualScale, 'f', 2, 64),
-					strconv.FormatFloat(float64(u.resp.latency.ValueAtQuantile(95))/actualScale, 'f', 2, 64),
-					strconv.FormatFloat(float64(u.resp.latency.ValueAtQuantile(99))/actualScale, 'f', 2, 64),
-					strconv.FormatFloat(float64(u.resp.latency.ValueAtQuantile(99.99))/actualScale, 'f', 2, 64),
-					strconv.FormatInt(u.resp.latency.TotalCount(), 10),
-				}
+				records := append([]string{string(u.subkey)}, latencyRecords(u.resp.latency, actualScale)...)
 				if typ != RawTrace {
 					records = append(records, []string{
 						strconv.FormatFloat(u.resp.rps.Mean(), 'f', 2, 64),
@@ -553,6 +905,106 @@ func (mm MetricsMap) print() string {
 			}
 			table.Render()
 
+			// Show the latency measured from the scheduled send time
+			// alongside, if the requests were paced by the runner
+			hasCorrected := false
+			for _, u := range resps {
+				if totalCount(u.resp.corrected) > 0 {
+					hasCorrected = true
+				}
+			}
+			if hasCorrected {
+				fmt.Fprintf(&out, "\nCorrected for coordinated omission (measured from scheduled send time):\n")
+				table := tablewriter.NewTable(&out)
+				hdrs := append([]string{subKeyDisplayName}, latencyHeaders()...)
+				hdrInterfaces := make([]any, len(hdrs))
+				for i, h := range hdrs {
+					hdrInterfaces[i] = h
+				}
+				table.Header(hdrInterfaces...)
+				for _, u := range resps {
+					if totalCount(u.resp.corrected) == 0 {
+						continue
+					}
+					table.Append(append([]string{string(u.subkey)}, latencyRecords(u.resp.corrected, actualScale)...))
+				}
+				table.Render()
+			}
+
+			// Failed requests alone, to tell fast rejections from
+			// timeouts
+			hasFailed := false
+			for _, u := range resps {
+				if totalCount(u.resp.failed) > 0 {
+					hasFailed = true
+				}
+			}
+			if hasFailed {
+				fmt.Fprintf(&out, "\nFailed requests:\n")
+				table := tablewriter.NewTable(&out)
+				hdrs := append([]string{subKeyDisplayName}, latencyHeaders()...)
+				hdrInterfaces := make([]any, len(hdrs))
+				for i, h := range hdrs {
+					hdrInterfaces[i] = h
+				}
+				table.Header(hdrInterfaces...)
+				for _, u := range resps {
+					if totalCount(u.resp.failed) == 0 {
+						continue
+					}
+					table.Append(append([]string{string(u.subkey)}, latencyRecords(u.resp.failed, actualScale)...))
+				}
+				table.Render()
+			}
+
+			// Throughput, for the generators measuring sizes
+			hasBytes := false
+			for _, u := range resps {
+				if u.resp.requestSize != nil {
+					hasBytes = true
+				}
+			}
+			if hasBytes {
+				fmt.Fprintf(&out, "\nThroughput (MB, sizes in bytes):\n")
+				table := tablewriter.NewTable(&out)
+				hdrs := append([]string{subKeyDisplayName}, bytesHeaders()...)
+				hdrInterfaces := make([]any, len(hdrs))
+				for i, h := range hdrs {
+					hdrInterfaces[i] = h
+				}
+				table.Header(hdrInterfaces...)
+				for _, u := range resps {
+					if u.resp.requestSize == nil {
+						continue
+					}
+					table.Append(append([]string{string(u.subkey)}, bytesRecords(u.resp, elapsed)...))
+				}
+				table.Render()
+			}
+
+			// Most frequent reasons of the failed requests
+			hasErrorReasons := false
+			for _, u := range resps {
+				if len(u.resp.errorReasons) > 0 {
+					hasErrorReasons = true
+				}
+			}
+			if hasErrorReasons {
+				fmt.Fprintf(&out, "\nTop errors:\n")
+				table := tablewriter.NewTable(&out)
+				table.Header(subKeyDisplayName, "Reason", "Count", "Percent")
+				for _, u := range resps {
+					for i, e := range u.resp.exportErrorReasons() {
+						if i == topErrorReasons {
+							break
+						}
+						table.Append([]string{string(u.subkey), e.Reason, strconv.Itoa(e.Count),
+							strconv.FormatFloat(float64(e.Count)*100/float64(u.resp.Errors), 'f', 2, 64)})
+					}
+				}
+				table.Render()
+			}
+
 			desc := ""
 			if typ != RawTrace {
 				desc = "Response time histogram (ms):"
@@ -566,6 +1018,38 @@ func (mm MetricsMap) print() string {
 	return out.String()
 }
 
+func latencyHeaders() []string {
+	hdrs := []string{"Avg", "StdDev", "Min", "Max"}
+	for _, p := range reportPercentiles {
+		hdrs = append(hdrs, "p"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+
+	return append(hdrs, "Total")
+}
+
+func latencyRecords(h *hdrhistogram.Histogram, scale float64) []string {
+	// Raw values aren't scaled
+	decimals := 2
+	if scale != 1 {
+		decimals = latencyDecimals
+	}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v/scale, 'f', decimals, 64)
+	}
+
+	records := []string{
+		format(h.Mean()),
+		format(h.StdDev()),
+		format(float64(h.Min())),
+		format(float64(h.Max())),
+	}
+	for _, p := range reportPercentiles {
+		records = append(records, format(float64(h.ValueAtQuantile(p))))
+	}
+
+	return append(records, strconv.FormatInt(h.TotalCount(), 10))
+}
+
 func (m *Metrics) Count() int {
 	return int(m.latency.TotalCount())
 }
@@ -576,10 +1060,36 @@ func (m *Metrics) Add(rtime int64) {
 	if err != nil {
 		log.Warnf("Failed to add value to histogram: %s", err.Error())
 	}
+	m.window.record(rtime)
+	m.live.record(rtime)
+	m.sink.record(rtime)
 
 	//Log.Debugf("TotalRequests = %d", this.hdrhist.TotalCount())
 }
 
+func (m *Metrics) AddCorrected(rtime int64) {
+	if m.corrected == nil {
+		m.corrected = newHistogram()
+	}
+	err := m.corrected.RecordValue(rtime)
+	if err != nil {
+		log.Warnf("Failed to add value to corrected histogram: %s", err.Error())
+	}
+	m.window.recordCorrected(rtime)
+	m.live.recordCorrected(rtime)
+	m.sink.recordCorrected(rtime)
+}
+
+func (m *Metrics) AddFailed(rtime int64) {
+	if m.failed == nil {
+		m.failed = newHistogram()
+	}
+	err := m.failed.RecordValue(rtime)
+	if err != nil {
+		log.Warnf("Failed to add value to failed histogram: %s", err.Error())
+	}
+}
+
 func (m *Metrics) updateRPS() {
 	n := time.Now()
 	if m.lastReftime.IsZero() {
@@ -607,6 +1117,27 @@ func (s *Stats) statsCollector() {
 		t.Stop()
 	}
 
+	var liveC <-chan time.Time
+	if s.liveInterval > 0 && !s.server {
+		lt := time.NewTicker(s.liveInterval)
+		defer lt.Stop()
+		liveC = lt.C
+	}
+
+	var sinkC <-chan time.Time
+	if len(s.sinks) > 0 && !s.server {
+		st := time.NewTicker(s.sinkInterval)
+		defer st.Stop()
+		sinkC = st.C
+	}
+
+	var hlogC <-chan time.Time
+	if s.hlog != nil && !s.server {
+		ht := time.NewTicker(s.hlog.interval)
+		defer ht.Stop()
+		hlogC = ht.C
+	}
+
 	for {
 		select {
 		case m := <-s.statsChan:
@@ -614,6 +1145,14 @@ func (s *Stats) statsCollector() {
 		case <-t.C:
 			s.flush()
 			s.statsRPSUpdate()
+		case now := <-s.intervalC:
+			s.snapshotIntervals(now)
+		case now := <-liveC:
+			s.liveReport(now)
+		case now := <-sinkC:
+			s.flushSinks(now)
+		case now := <-hlogC:
+			s.writeHistogramLog(now)
 
 		case c := <-s.statsCmd:
 			switch c.cmd {
@@ -632,9 +1171,38 @@ func (s *Stats) statsCollector() {
 				s.reset()
 				close(c.done)
 			case statsCmdResetMetrics:
+				// Results sent before the reset are dropped with it
+				s.flush()
 				s.resetMetrics()
 				close(c.done)
+			case statsCmdStage:
+				s.stages = append(s.stages, c.arg.(Stage))
+				close(c.done)
+			case statsCmdWorkers:
+				s.recordWorkers(c.arg.(WorkerEvent))
+				if s.otlp != nil {
+					s.otlp.recordWorkers(c.arg.(WorkerEvent).Workers)
+				}
+				close(c.done)
+			case statsCmdAbandoned:
+				s.abandoned += c.arg.(int)
+				close(c.done)
+			case statsCmdBudget:
+				// Budgets of the runs sharing the stats add up
+				b := c.arg.(Budget)
+				if s.budget == nil {
+					s.budget = &b
+				} else {
+					s.budget.merge(&b)
+				}
+				close(c.done)
 			case statsCmdQuit:
+				if sinkC != nil {
+					s.flushSinks(time.Now())
+				}
+				if hlogC != nil {
+					s.writeHistogramLog(time.Now())
+				}
 				close(c.done)
 				return
 			}
@@ -648,6 +1216,26 @@ func (s *Stats) reset() {
 	s.concurrency = 0
 	s.duration = 0
 	s.digestToQuery = make(map[string]string)
+	s.stages = nil
+	s.budget = nil
+	s.abandoned = 0
+	s.workers = nil
+}
+
+// Events of the same kind in quick succession (ex: workers starting) are
+// merged to keep the timeline short
+const workerEventMerge = time.Second
+
+func (s *Stats) recordWorkers(e WorkerEvent) {
+	if n := len(s.workers); n > 0 {
+		last := &s.workers[n-1]
+		if last.Event == e.Event && e.Time.Sub(last.Time) < workerEventMerge {
+			last.Workers = e.Workers
+			return
+		}
+	}
+
+	s.workers = append(s.workers, e)
 }
 
 func (s *Stats) resetMetrics() {
@@ -656,6 +1244,20 @@ func (s *Stats) resetMetrics() {
 	s.endTime = time.Now()
 	s.importCount = 0
 	s.digestToQuery = make(map[string]string)
+	if s.interval > 0 && !s.server {
+		s.startInterval(s.startTime)
+	}
+	s.liveStart = s.startTime
+	s.sinkStart = s.startTime
+	if s.hlog != nil {
+		s.hlog.start = s.startTime
+	}
+	if s.otlp != nil {
+		s.otlp = s.otlp.restart()
+		if n := len(s.workers); n > 0 {
+			s.otlp.recordWorkers(s.workers[n-1].Workers)
+		}
+	}
 }
 
 func (s *Stats) handleMetric(t *TraceInfo) {
@@ -666,10 +1268,48 @@ func (s *Stats) handleMetric(t *TraceInfo) {
 		s.digestToQuery[d] = q
 	}
 
+	m := s.metrics.getMetrics(t.Type, Key(t.Key), Subkey(t.Subkey))
+	if s.interval > 0 && m.window == nil {
+		m.window = newWindow(m.Errors)
+	}
+	if s.liveInterval > 0 && !s.server && m.live == nil {
+		m.live = newWindow(m.Errors)
+	}
+	if len(s.sinks) > 0 && !s.server && m.sink == nil {
+		m.sink = newWindow(m.Errors)
+	}
+	if s.hlog != nil && !s.server && t.Type != RawTrace && m.hlog == nil {
+		m.hlog = newLogHistogram()
+	}
+
 	s.metrics.update(t)
+	s.endTime = time.Now()
+	if m.hlog != nil && t.Total != 0 {
+		if err := m.hlog.RecordValue(int64(t.Total)); err != nil {
+			log.Warnf("Failed to add value to histogram log: %s", err.Error())
+		}
+	}
+	if s.otlp != nil {
+		s.otlp.record(t)
+	}
 }
 
 func (s *Stats) RecordMetric(t *TraceInfo) {
+	if s.scope != "" {
+		scoped := *t
+		scoped.Key = s.scope + "/" + t.Key
+		t = &scoped
+	}
+
+	// Must be computed here, in the caller's goroutine, as metrics are
+	// processed asynchronously
+	if !t.Scheduled.IsZero() && t.Total != 0 && t.Type != RawTrace {
+		t.corrected = time.Since(t.Scheduled)
+		if t.corrected < t.Total {
+			t.corrected = t.Total
+		}
+	}
+
 	s.statsChan <- t
 }
 
@@ -682,12 +1322,24 @@ func (s *Stats) export() *Report {
 	if s.endTime.IsZero() {
 		s.endTime = time.Now()
 	}
+	slot, start := s.currentInterval()
 
 	var w *int
 	if s.importCount > 0 {
 		w = intPtr(s.importCount)
 	}
 
+	var abandoned *int
+	if s.abandoned > 0 {
+		abandoned = intPtr(s.abandoned)
+	}
+
+	var budget *Budget
+	if s.budget != nil {
+		b := *s.budget
+		budget = &b
+	}
+
 	return &Report{
 		Id:            s.id,
 		Requestrate:   s.requestrate,
@@ -695,7 +1347,11 @@ func (s *Stats) export() *Report {
 		Duration:      fmt.Sprint(s.duration),
 		StartTime:     s.startTime,
 		EndTime:       s.endTime,
-		Results:       s.metrics.export(),
+		Stages:        append([]Stage(nil), s.stages...),
+		Budget:        budget,
+		Abandoned:     abandoned,
+		Workers:       append([]WorkerEvent(nil), s.workers...),
+		Results:       s.metrics.export(slot, start, s.endTime.Sub(s.startTime)),
 		DigestToQuery: dq,
 		NumWorkers:    w,
 	}
@@ -720,6 +1376,22 @@ func (s *Stats) importReport(report *Report) {
 
 	s.importCount++
 
+	// All clients are expected to run the same profile
+	if len(s.stages) == 0 {
+		s.stages = append(s.stages, report.Stages...)
+	}
+
+	if report.Abandoned != nil {
+		s.abandoned += *report.Abandoned
+	}
+
+	if report.Budget != nil {
+		if s.budget == nil {
+			s.budget = &Budget{Met: true}
+		}
+		s.budget.merge(report.Budget)
+	}
+
 	s.metrics.importReport(report)
 
 	for k, m := range report.DigestToQuery {
@@ -749,7 +1421,14 @@ func (s *Stats) print() string {
 	if s.importCount > 0 {
 		fmt.Fprintf(&out, "\nMerics collected from %v remote workers\n", s.importCount)
 	}
-	fmt.Fprintf(&out, "%v", s.metrics.print())
+	fmt.Fprintf(&out, "%v", s.metrics.print(s.endTime.Sub(s.startTime)))
+	if s.budget != nil {
+		fmt.Fprintf(&out, "\n%s\n", s.budget)
+	}
+	if s.abandoned > 0 {
+		fmt.Fprintf(&out, "\nAbandoned requests (in flight at stop timeout): %d\n", s.abandoned)
+	}
+	fmt.Fprintf(&out, "%s", s.printWorkers())
 	if len(s.digestToQuery) > 0 {
 		fmt.Fprintf(&out, "Digest to query mapping:\n")
 		for k, v := range s.digestToQuery {
@@ -761,6 +1440,31 @@ func (s *Stats) print() string {
 	return out.String()
 }
 
+// printWorkers shows the worker timeline, if the number of workers changed
+// while generating load
+func (s *Stats) printWorkers() string {
+	changed := false
+	for _, e := range s.workers {
+		if e.Event != WorkersStarted && e.Event != WorkersDone {
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\nWorkers over time:\n")
+	table := tablewriter.NewTable(&out)
+	table.Header([]string{"Time", "Workers", "Event"})
+	for _, e := range s.workers {
+		table.Append([]string{e.Time.Format("15:04:05.000"), fmt.Sprint(e.Workers), e.Event})
+	}
+	table.Render()
+
+	return out.String()
+}
+
 func printHistogram(title string, description string, hdrhist *hdrhistogram.Histogram, scale float64) string {
 	var o strings.Builder
 	buckets := getHistogramBuckets(hdrhist, scale)
@@ -2,9 +2,24 @@ package stats
 
 import (
 	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -12,6 +27,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestHistogram(t *testing.T) {
@@ -227,3 +245,758 @@ func TestBarsToBuckets(t *testing.T) {
 	}
 	require.Equal(int64(25), count)
 }
+
+func TestCorrectedLatency(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	defer s.Stop()
+
+	s.RecordMetric(&TraceInfo{
+		Type:      HttpTrace,
+		Key:       "target",
+		Subkey:    "scheduled",
+		Total:     100 * time.Millisecond,
+		Status:    200,
+		Scheduled: time.Now().Add(-500 * time.Millisecond),
+	})
+	s.RecordMetric(&TraceInfo{
+		Type:   HttpTrace,
+		Key:    "target",
+		Subkey: "unscheduled",
+		Total:  100 * time.Millisecond,
+		Status: 200,
+	})
+
+	report := s.Export()
+	require.Equal(t, 2, len(report.Results))
+	for _, r := range report.Results {
+		assert.InEpsilon(t, 100, r.Histogram.Max, 0.1)
+		switch r.SubTarget {
+		case "scheduled":
+			require.NotNil(t, r.Corrected)
+			assert.Equal(t, int64(1), r.Corrected.Count)
+			assert.GreaterOrEqual(t, r.Corrected.Max, 500.0)
+		case "unscheduled":
+			assert.Nil(t, r.Corrected)
+		}
+	}
+
+	assert.Contains(t, s.Report(), "Corrected for coordinated omission")
+}
+
+func TestThresholds(t *testing.T) {
+	thresholds, err := ParseThresholds("p99<200ms, p99.9<=1s,avg<50,errors<0.1%,errors<=3,rps>=10")
+	require.NoError(t, err)
+	require.Equal(t, 6, len(thresholds))
+	assert.Equal(t, 200.0, thresholds[0].Value)
+	assert.Equal(t, 1000.0, thresholds[1].Value)
+	assert.Equal(t, 50.0, thresholds[2].Value)
+	assert.True(t, thresholds[3].Percent)
+	assert.False(t, thresholds[4].Percent)
+	assert.Equal(t, "p99.9<=1s", thresholds[1].String())
+
+	for _, s := range []string{"", "p99", "p99<", "foo<1", "p200<1ms", "p99<abc", "errors<x%"} {
+		_, err := ParseThresholds(s)
+		assert.Errorf(t, err, "%s", s)
+	}
+
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	defer s.Stop()
+
+	for i := 1; i <= 100; i++ {
+		s.RecordMetric(&TraceInfo{
+			Type:   HttpTrace,
+			Key:    "target",
+			Subkey: "/",
+			Total:  time.Duration(i) * time.Millisecond,
+			Status: 200,
+		})
+	}
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Error: true})
+
+	report := s.Export()
+	require.Equal(t, 1, len(report.Results))
+	r := &report.Results[0]
+
+	v, ok := thresholds[0].Check(r)
+	assert.True(t, ok)
+	assert.InEpsilon(t, 99, v, 0.01)
+
+	v, ok = thresholds[2].Check(r)
+	assert.False(t, ok)
+	assert.InEpsilon(t, 50.5, v, 0.01)
+
+	v, ok = thresholds[3].Check(r)
+	assert.False(t, ok)
+	assert.InEpsilon(t, 100.0/101, v, 0.01)
+
+	_, ok = thresholds[4].Check(r)
+	assert.True(t, ok)
+
+	// Failed requests with a latency are counted once
+	for i := 0; i < 99; i++ {
+		s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: time.Millisecond, Status: 503, Error: true})
+	}
+
+	report = s.Export()
+	r = &report.Results[0]
+	assert.Equal(t, int64(199), r.Histogram.Count)
+	require.NotNil(t, r.Failed)
+	assert.Equal(t, int64(99), r.Failed.Count)
+
+	v, ok = thresholds[3].Check(r)
+	assert.False(t, ok)
+	assert.InEpsilon(t, 50, v, 0.01)
+}
+
+func TestIntervals(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.SetInterval(time.Second)
+	s.Start()
+	defer s.Stop()
+
+	record := func(d time.Duration, failed bool) {
+		s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: d, Status: 200, Error: failed})
+	}
+
+	record(10*time.Millisecond, false)
+	record(20*time.Millisecond, true)
+
+	// Wait for the next interval
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(1100 * time.Millisecond)))
+	record(100*time.Millisecond, false)
+
+	report := s.Export()
+	require.Equal(t, 1, len(report.Results))
+	intervals := report.Results[0].Intervals
+	require.Equal(t, 2, len(intervals))
+
+	assert.Equal(t, int64(2), intervals[0].Count)
+	assert.Equal(t, 1, intervals[0].Errors)
+	assert.InEpsilon(t, 20, intervals[0].Max, 0.1)
+	assert.Equal(t, int64(1), intervals[1].Count)
+	assert.Zero(t, intervals[1].Errors)
+	assert.InEpsilon(t, 100, intervals[1].Percentiles[0].Value, 0.1)
+	assert.Equal(t, time.Second, intervals[1].Start.Sub(intervals[0].Start))
+	assert.Equal(t, intervals[1].Start, intervals[1].Start.Truncate(time.Second))
+
+	// Merged with the same intervals of another client
+	s.Import(report)
+	merged := s.Export().Results[0].Intervals
+	require.Equal(t, 2, len(merged))
+	assert.Equal(t, int64(4), merged[0].Count)
+	assert.Equal(t, 2, merged[0].Errors)
+	assert.Equal(t, int64(2), merged[1].Count)
+	assert.InEpsilon(t, 100, merged[1].Max, 0.1)
+}
+
+func TestLiveReport(t *testing.T) {
+	var out bytes.Buffer
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	require.NoError(t, s.SetLiveReport(time.Second, "text", &out))
+	s.Start()
+
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 10 * time.Millisecond, Status: 200})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 20 * time.Millisecond, Status: 500, Error: true})
+	time.Sleep(1100 * time.Millisecond)
+	s.Stop()
+
+	assert.Regexp(t, `^\d\d:\d\d:\d\d http target /: 2\.0 rps, p50 10\.0\dms, p99 20\.0\dms, 1 errors \| total: 2, 2\.0 rps, p99 20\.0\dms, 1 errors\n$`, out.String())
+
+	// JSON lines, run by hand
+	out.Reset()
+	s = New(uuid.New().String(), 1, 1, 0, false)
+	require.NoError(t, s.SetLiveReport(time.Second, "json", &out))
+	assert.Error(t, s.SetLiveReport(time.Second, "xml", &out))
+
+	s.handleMetric(&TraceInfo{Type: RedisTrace, Key: "redis", Subkey: "GET", Total: 5 * time.Millisecond})
+	s.liveReport(time.Now())
+	s.handleMetric(&TraceInfo{Type: RedisTrace, Key: "redis", Subkey: "GET", Total: 5 * time.Millisecond})
+	s.liveReport(time.Now())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	var l LiveReport
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &l))
+	assert.Equal(t, "GET", l.SubTarget)
+	assert.Equal(t, int64(1), l.Interval.Count)
+	assert.Equal(t, int64(2), l.Total.Count)
+
+	// p50 and p99 whatever the percentiles reported
+	defer restoreHistogram()()
+	SetPercentiles([]float64{90})
+	out.Reset()
+	s = New(uuid.New().String(), 1, 1, 0, false)
+	require.NoError(t, s.SetLiveReport(time.Second, "text", &out))
+	s.handleMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 10 * time.Millisecond, Status: 200})
+	s.liveReport(time.Now())
+	assert.Regexp(t, `: [\d.]+ rps, p50 10\.0\dms, p99 10\.0\dms, 0 errors \| total: 1, [\d.]+ rps, p99 10\.0\dms, 0 errors\n$`, out.String())
+}
+
+func TestPrometheus(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	defer s.Stop()
+
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 8 * time.Millisecond, Status: 200})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 200 * time.Millisecond, Status: 500, Error: true})
+	s.RecordWorkers(3, WorkersStarted)
+
+	w := httptest.NewRecorder()
+	s.PrometheusHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	labels := `subtarget="/",target="target",type="http"`
+	assert.Contains(t, body, `lg_requests_total{`+labels+`} 2`)
+	assert.Contains(t, body, `lg_errors_total{`+labels+`} 1`)
+	assert.Contains(t, body, `lg_http_responses_total{class="2xx",`+labels+`} 1`)
+	assert.Contains(t, body, `lg_http_responses_total{class="5xx",`+labels+`} 1`)
+	assert.Contains(t, body, `lg_request_duration_seconds_bucket{`+labels+`,le="0.005"} 0`)
+	assert.Contains(t, body, `lg_request_duration_seconds_bucket{`+labels+`,le="0.01"} 1`)
+	assert.Contains(t, body, `lg_request_duration_seconds_bucket{`+labels+`,le="0.25"} 2`)
+	assert.Contains(t, body, `lg_request_duration_seconds_count{`+labels+`} 2`)
+	assert.Contains(t, body, `lg_workers 3`)
+}
+
+func TestOTLP(t *testing.T) {
+	// Collector stand-in
+	var mux sync.Mutex
+	var requests []*colmetricpb.ExportMetricsServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := &colmetricpb.ExportMetricsServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, req))
+
+		mux.Lock()
+		requests = append(requests, req)
+		mux.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		resp, _ := proto.Marshal(&colmetricpb.ExportMetricsServiceResponse{})
+		w.Write(resp)
+	}))
+	defer srv.Close()
+
+	id := uuid.New().String()
+	s := New(id, 1, 1, 0, false)
+	o := NewOTLPOptions()
+	o.Endpoint = srv.URL
+	o.Protocol = "http"
+	o.Command = "http"
+	require.NoError(t, s.SetOTLP(*o))
+	s.Start()
+
+	// Warmup, not pushed
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 50 * time.Millisecond, Status: 200})
+	s.RecordWorkers(2, WorkersStarted)
+	s.ResetMetrics()
+
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 10 * time.Millisecond, Status: 200})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 20 * time.Millisecond, Status: 503, Error: true})
+	s.Export()
+	s.Stop()
+
+	mux.Lock()
+	defer mux.Unlock()
+	require.NotEmpty(t, requests)
+	rm := requests[len(requests)-1].ResourceMetrics[0]
+
+	resource := map[string]string{}
+	for _, a := range rm.Resource.Attributes {
+		resource[a.Key] = a.Value.GetStringValue()
+	}
+	assert.Equal(t, id, resource["lg.run.id"])
+	assert.Equal(t, "http", resource["lg.command"])
+	assert.NotEmpty(t, resource["host.name"])
+
+	metrics := map[string]*metricpb.Metric{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	latency := metrics["lg.request.duration"].GetExponentialHistogram()
+	require.NotNil(t, latency)
+	require.Equal(t, 1, len(latency.DataPoints))
+	assert.Equal(t, uint64(2), latency.DataPoints[0].Count)
+	assert.InDelta(t, 0.03, latency.DataPoints[0].GetSum(), 0.0001)
+
+	assert.Equal(t, int64(2), metrics["lg.requests"].GetSum().DataPoints[0].GetAsInt())
+	assert.Equal(t, int64(1), metrics["lg.errors"].GetSum().DataPoints[0].GetAsInt())
+	assert.Equal(t, 2, len(metrics["lg.http.responses"].GetSum().DataPoints))
+	assert.Equal(t, int64(2), metrics["lg.workers"].GetGauge().DataPoints[0].GetAsInt())
+
+	assert.Error(t, New(id, 1, 1, 0, false).SetOTLP(OTLPOptions{Endpoint: srv.URL, Protocol: "udp"}))
+}
+
+// Sink writing to a channel
+type chanSink chan []SinkPoint
+
+func (c chanSink) Write(points []SinkPoint) error {
+	c <- points
+	return nil
+}
+
+func (c chanSink) Close() error {
+	close(c)
+	return nil
+}
+
+func TestSinks(t *testing.T) {
+	point := SinkPoint{
+		Time:      time.Unix(1700000000, 0),
+		Type:      "http",
+		Target:    "http://example.com",
+		SubTarget: "/",
+		Interval: Interval{Count: 2, Errors: 1, RPS: 0.2, Min: 10, Max: 20, Avg: 15,
+			Percentiles: []Percentile{{50, 10}, {99.99, 20}}},
+	}
+
+	t.Run("Stats", func(t *testing.T) {
+		sink := make(chanSink, 10)
+		s := New(uuid.New().String(), 1, 1, 0, false)
+		s.SetSinks(time.Second, sink)
+		s.Start()
+
+		s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 10 * time.Millisecond, Status: 200})
+		s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 20 * time.Millisecond, Status: 500, Error: true})
+		time.Sleep(1100 * time.Millisecond)
+		s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 30 * time.Millisecond, Status: 200})
+		s.Stop()
+
+		var points []SinkPoint
+		for p := range sink {
+			points = append(points, p...)
+		}
+		require.Equal(t, 2, len(points))
+		assert.Equal(t, "target", points[0].Target)
+		assert.Equal(t, int64(2), points[0].Count)
+		assert.Equal(t, 1, points[0].Errors)
+		assert.Equal(t, int64(1), points[1].Count)
+		assert.Equal(t, 0, points[1].Errors)
+		assert.InDelta(t, 30.0, points[1].Max, 0.1)
+	})
+
+	t.Run("Statsd", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		sink, err := NewSink("statsd://"+conn.LocalAddr().String(), "")
+		require.NoError(t, err)
+		defer sink.Close()
+		require.NoError(t, sink.Write([]SinkPoint{point}))
+
+		buf := make([]byte, statsdPacketSize)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, strings.Join([]string{
+			"lg.http.http_example_com.count:2|c",
+			"lg.http.http_example_com.errors:1|c",
+			"lg.http.http_example_com.rps:0.2|g",
+			"lg.http.http_example_com.min:10|g",
+			"lg.http.http_example_com.max:20|g",
+			"lg.http.http_example_com.avg:15|g",
+			"lg.http.http_example_com.p50:10|g",
+			"lg.http.http_example_com.p99_99:20|g",
+		}, "\n"), string(buf[:n]))
+	})
+
+	t.Run("Graphite", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+
+		sink, err := NewSink("graphite://"+l.Addr().String(), "loadtest.{{.SubTarget}}.{{.Target}}")
+		require.NoError(t, err)
+		require.NoError(t, sink.Write([]SinkPoint{point}))
+		require.NoError(t, sink.Close())
+
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		data, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Equal(t, 8, len(lines))
+		assert.Equal(t, "loadtest.http_example_com.count 2 1700000000", lines[0])
+		assert.Equal(t, "loadtest.http_example_com.p99_99 20 1700000000", lines[7])
+	})
+
+	t.Run("Influx", func(t *testing.T) {
+		var body string
+		var auth string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+			auth = r.Header.Get("Authorization")
+			assert.Equal(t, "/write", r.URL.Path)
+			assert.Equal(t, "lg", r.URL.Query().Get("db"))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		t.Setenv("INFLUX_TOKEN", "secret")
+		u := strings.Replace(srv.URL, "http://", "influx://", 1) + "/write?db=lg"
+		sink, err := NewSink(u, "")
+		require.NoError(t, err)
+		p := point
+		p.SubTarget = "/a b"
+		require.NoError(t, sink.Write([]SinkPoint{p}))
+		assert.Equal(t, `lg,subtarget=/a\ b,target=http://example.com,type=http count=2i,errors=1i,rps=0.2,min=10,max=20,avg=15,p50=10,p99_99=20 1700000000000000000`+"\n", body)
+		assert.Equal(t, "Token secret", auth)
+	})
+
+	_, err := NewSink("kafka://localhost:9092", "")
+	assert.Error(t, err)
+	_, err = NewSink("statsd://localhost:8125", "{{.Unknown}}")
+	assert.Error(t, err)
+}
+
+func TestExportFormats(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/fast", Total: 10 * time.Millisecond, Status: 200})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/slow", Total: 20 * time.Millisecond, Status: 500, Error: true})
+	report := s.Export()
+	s.Stop()
+	sort.Slice(report.Results, func(i, j int) bool { return report.Results[i].SubTarget < report.Results[j].SubTarget })
+
+	var out bytes.Buffer
+	require.NoError(t, report.Write(&out, FormatCSV, nil))
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(rows))
+	row := map[string]string{}
+	for i, col := range rows[0] {
+		row[col] = rows[2][i]
+	}
+	assert.Equal(t, "/slow", row["subtarget"])
+	assert.Equal(t, "1", row["count"])
+	assert.Equal(t, "1", row["errors"])
+	assert.Equal(t, "1", row["5xx"])
+	assert.Equal(t, "unknown=1", row["error_reasons"])
+	assert.Equal(t, "20.015", row["p99"])
+	assert.Equal(t, "", row["corrected_p99"])
+
+	out.Reset()
+	thresholds, err := ParseThresholds("p99<15ms,errors<1")
+	require.NoError(t, err)
+	require.NoError(t, report.Write(&out, FormatJUnit, thresholds))
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(out.Bytes(), &suites))
+	assert.Equal(t, 2, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	cases := suites.Suites[0].Cases
+	assert.Equal(t, "http.target", cases[0].ClassName)
+	assert.Nil(t, cases[0].Failure)
+	require.NotNil(t, cases[1].Failure)
+	assert.Equal(t, "threshold breached: p99<15ms (observed 20.02ms), errors<1 (observed 1)", cases[1].Failure.Message)
+
+	assert.Equal(t, 2, len(report.Breaches(thresholds)))
+	assert.Error(t, report.Write(&out, "xml", nil))
+}
+
+func TestPercentilesAndHistogram(t *testing.T) {
+	p, err := ParsePercentiles("99.9, p50,99.999")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{50, 99.9, 99.999}, p)
+	for _, s := range []string{"", "0", "101", "p9x"} {
+		_, err := ParsePercentiles(s)
+		assert.Error(t, err, s)
+	}
+
+	assert.Error(t, SetHistogram(time.Minute, 6, time.Microsecond))
+	assert.Error(t, SetHistogram(time.Microsecond, 3, time.Microsecond))
+	assert.Error(t, SetHistogram(time.Minute, 3, 0))
+	assert.Error(t, SetHistogram(time.Minute, 3, 3*time.Nanosecond))
+
+	defer restoreHistogram()()
+
+	SetPercentiles(p)
+	require.NoError(t, SetHistogram(10*time.Minute, 4, time.Microsecond))
+
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	s.RecordMetric(&TraceInfo{Type: CustomTrace, Key: "batch", Subkey: "job", Total: 8 * time.Minute})
+	s.RecordMetric(&TraceInfo{Type: CustomTrace, Key: "batch", Subkey: "job", Total: 10 * time.Millisecond})
+	report := s.Export()
+	out := s.Report()
+	s.Stop()
+
+	require.Equal(t, 1, len(report.Results))
+	h := report.Results[0].Histogram
+	assert.Equal(t, int64(2), h.Count)
+	assert.Equal(t, []float64{50, 99.9, 99.999}, []float64{h.Percentiles[0].Percentile, h.Percentiles[1].Percentile, h.Percentiles[2].Percentile})
+	assert.InDelta(t, 480000.0, h.Percentiles[2].Value, 480000*0.0001)
+	assert.Contains(t, out, "P 99 . 999")
+}
+
+// restoreHistogram gives a function restoring the histogram settings
+func restoreHistogram() func() {
+	p, max, digits, unit, sc, decimals := reportPercentiles, maxHistogramValue, histogramDigits, histogramUnit, scale, latencyDecimals
+	return func() {
+		reportPercentiles, maxHistogramValue, histogramDigits, histogramUnit, scale, latencyDecimals = p, max, digits, unit, sc, decimals
+	}
+}
+
+func TestHistogramUnit(t *testing.T) {
+	defer restoreHistogram()()
+
+	record := func() (*Report, string) {
+		s := New(uuid.New().String(), 1, 1, 0, false)
+		s.Start()
+		s.RecordMetric(&TraceInfo{Type: RedisTrace, Key: "localhost", Subkey: "GET", Total: 300 * time.Nanosecond})
+		s.RecordMetric(&TraceInfo{Type: RedisTrace, Key: "localhost", Subkey: "GET", Total: 700 * time.Nanosecond})
+		report := s.Export()
+		out := s.Report()
+		s.Stop()
+		return report, out
+	}
+
+	// Sub-microsecond latencies are lost in microseconds
+	report, _ := record()
+	assert.Equal(t, 0.0, report.Results[0].Histogram.Max)
+
+	require.NoError(t, SetHistogram(time.Minute, 3, time.Nanosecond))
+	report, out := record()
+	h := report.Results[0].Histogram
+	assert.Equal(t, int64(2), h.Count)
+	assert.InDelta(t, 0.0003, h.Min, 0.000001)
+	assert.InDelta(t, 0.0007, h.Max, 0.000001)
+	assert.InDelta(t, 0.0005, h.Avg, 0.000001)
+	assert.Contains(t, out, "0.00030")
+	assert.Equal(t, "0.00070ms", Threshold{Metric: "max"}.FormatValue(h.Max))
+}
+
+func TestHistogramLog(t *testing.T) {
+	var out bytes.Buffer
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.SetHistogramLog(&out, time.Second)
+	s.Start()
+
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/a b,c", Total: 1500 * time.Nanosecond, Status: 200})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/a b,c", Total: 20 * time.Millisecond, Status: 200})
+	s.RecordMetric(&TraceInfo{Type: RawTrace, Key: "raw", Total: 42})
+	time.Sleep(1100 * time.Millisecond)
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/a b,c", Total: 30 * time.Millisecond, Status: 200})
+	s.Stop()
+
+	assert.True(t, strings.HasPrefix(out.String(), "#[Histogram log format version 1.3]\n"))
+
+	r := hdrhistogram.NewHistogramLogReader(&out)
+	var hists []*hdrhistogram.Histogram
+	for {
+		h, err := r.NextIntervalHistogram()
+		require.NoError(t, err)
+		if h == nil {
+			break
+		}
+		hists = append(hists, h)
+	}
+
+	require.Equal(t, 2, len(hists))
+	assert.Equal(t, "http/target//a_b_c", hists[0].Tag())
+	assert.Equal(t, int64(2), hists[0].TotalCount())
+	assert.Equal(t, int64(1500), hists[0].Min())
+	assert.InDelta(t, float64(20*time.Millisecond), float64(hists[0].Max()), float64(20*time.Millisecond)*0.001)
+	assert.Equal(t, int64(1), hists[1].TotalCount())
+	assert.InDelta(t, float64(s.startTime.UnixNano()/1e6), float64(hists[0].StartTimeMs()), 1)
+	assert.Less(t, hists[0].EndTimeMs(), hists[1].EndTimeMs())
+}
+
+func TestErrorReasons(t *testing.T) {
+	for err, reason := range map[error]string{
+		nil:                           "",
+		context.DeadlineExceeded:      ErrorTimeout,
+		fmt.Errorf("get: %w", io.EOF): ErrorEOF,
+		&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}: ErrorConnectionRefused,
+		&net.DNSError{Err: "no such host", Name: "nowhere"}:                                ErrorDNS,
+		&url.Error{Op: "Get", URL: "https://target", Err: x509.UnknownAuthorityError{}}:    ErrorTLS,
+		errors.New("boom"): ErrorOther,
+	} {
+		assert.Equal(t, reason, ErrorReason(err), "%v", err)
+	}
+
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	for i := 0; i < 3; i++ {
+		s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Error: true, ErrorReason: ErrorTimeout})
+	}
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Error: true, ErrorReason: ErrorConnectionRefused})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Error: true})
+	for i := 0; i < maxErrorReasons; i++ {
+		s.RecordMetric(&TraceInfo{Type: GrpcTrace, Key: "target", Subkey: "method", Error: true, ErrorReason: fmt.Sprintf("code %d", i)})
+	}
+	s.RecordMetric(&TraceInfo{Type: GrpcTrace, Key: "target", Subkey: "method", Error: true, ErrorReason: "code 99"})
+	report := s.Export()
+	out := s.Report()
+
+	s.Import(report)
+	merged := s.Export()
+	s.Stop()
+
+	require.Equal(t, 2, len(report.Results))
+	sort.Slice(report.Results, func(i, j int) bool { return report.Results[i].Type > report.Results[j].Type })
+	assert.Equal(t, []ErrorCount{{ErrorTimeout, 3}, {ErrorConnectionRefused, 1}, {ErrorUnknown, 1}}, report.Results[0].ErrorReasons)
+	assert.Equal(t, maxErrorReasons, len(report.Results[1].ErrorReasons))
+	assert.Contains(t, report.Results[1].ErrorReasons, ErrorCount{ErrorOther, 2})
+
+	assert.Contains(t, out, "Top errors:")
+	assert.Contains(t, out, "connection refused")
+
+	sort.Slice(merged.Results, func(i, j int) bool { return merged.Results[i].Type > merged.Results[j].Type })
+	assert.Equal(t, ErrorCount{ErrorTimeout, 6}, merged.Results[0].ErrorReasons[0])
+}
+
+func TestFailedLatency(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 100 * time.Millisecond, Status: 200})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 2 * time.Millisecond, Error: true})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Error: true})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/ok", Total: 10 * time.Millisecond, Status: 200})
+	report := s.Export()
+	out := s.Report()
+
+	s.Import(report)
+	merged := s.Export()
+	s.Stop()
+
+	sort.Slice(report.Results, func(i, j int) bool { return report.Results[i].SubTarget < report.Results[j].SubTarget })
+	r := report.Results[0]
+	assert.Equal(t, int64(2), r.Histogram.Count)
+	assert.Equal(t, 2, *r.Errors)
+	require.NotNil(t, r.Failed)
+	assert.Equal(t, int64(1), r.Failed.Count)
+	assert.InDelta(t, 2.0, r.Failed.Max, 0.01)
+	assert.Nil(t, report.Results[1].Failed)
+
+	assert.Contains(t, out, "Failed requests:")
+
+	var csvOut bytes.Buffer
+	require.NoError(t, report.Write(&csvOut, FormatCSV, nil))
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	require.NoError(t, err)
+	row := map[string]string{}
+	for i, col := range rows[0] {
+		row[col] = rows[1][i]
+	}
+	assert.Equal(t, "1", row["failed_count"])
+	assert.Equal(t, "2.000", row["failed_p99"])
+
+	for _, r := range merged.Results {
+		if r.SubTarget == "/" {
+			require.NotNil(t, r.Failed)
+			assert.Equal(t, int64(2), r.Failed.Count)
+		}
+	}
+}
+
+func TestLazyHistograms(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.SetInterval(time.Second)
+	s.Start()
+	s.RecordMetric(&TraceInfo{Type: RedisTrace, Key: "db", Subkey: "GET", Total: time.Millisecond})
+	s.RecordMetric(&TraceInfo{Type: RedisTrace, Key: "db", Subkey: "SET", Total: time.Millisecond, Error: true, Scheduled: time.Now()})
+	report := s.Export()
+	s.Stop()
+
+	// Only the histograms recorded to are there
+	m1 := s.metrics.getMetrics(RedisTrace, "db", "GET")
+	assert.Nil(t, m1.corrected)
+	assert.Nil(t, m1.failed)
+	assert.Nil(t, m1.window.corrected)
+	assert.NotNil(t, m1.window.latency)
+
+	m2 := s.metrics.getMetrics(RedisTrace, "db", "SET")
+	assert.NotNil(t, m2.corrected)
+	assert.NotNil(t, m2.failed)
+	assert.NotNil(t, m2.window.corrected)
+
+	require.Equal(t, 2, len(report.Results))
+	for _, r := range report.Results {
+		assert.Equal(t, int64(1), r.Histogram.Count)
+	}
+}
+
+func TestScoped(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	a, b := s.Scoped("a"), s.Scoped("b")
+	a.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "http://target", Subkey: "GET", Total: time.Millisecond})
+	b.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "http://target", Subkey: "GET", Total: time.Millisecond})
+	b.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "http://target", Subkey: "GET", Total: time.Millisecond})
+	a.RecordBudget(Budget{Iterations: 5, Done: 5, Met: true})
+	b.RecordBudget(Budget{Iterations: 3, Done: 2, Reason: "tick failed"})
+	report := s.Export()
+	s.Stop()
+
+	// The same target of each scope apart
+	counts := map[string]int64{}
+	for _, r := range report.Results {
+		counts[r.Target] = r.Histogram.Count
+	}
+	assert.Equal(t, map[string]int64{"a/http://target": 1, "b/http://target": 2}, counts)
+
+	// Budgets add up
+	require.NotNil(t, report.Budget)
+	assert.Equal(t, Budget{Iterations: 8, Done: 7, Reason: "tick failed"}, *report.Budget)
+}
+
+func TestBytes(t *testing.T) {
+	s := New(uuid.New().String(), 1, 1, 0, false)
+	s.Start()
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/upload", Total: 10 * time.Millisecond, RequestSize: 1000, ResponseSize: 20, Sized: true})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/upload", Total: 10 * time.Millisecond, RequestSize: 3000, ResponseSize: 20, Sized: true})
+	time.Sleep(100 * time.Millisecond)
+	// Empty ones count as well
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/upload", Total: 10 * time.Millisecond, Sized: true})
+	s.RecordMetric(&TraceInfo{Type: HttpTrace, Key: "target", Subkey: "/", Total: 10 * time.Millisecond})
+	report := s.Export()
+	out := s.Report()
+
+	s.Import(report)
+	merged := s.Export()
+	s.Stop()
+
+	sort.Slice(report.Results, func(i, j int) bool { return report.Results[i].SubTarget < report.Results[j].SubTarget })
+	assert.Nil(t, report.Results[0].Bytes)
+	b := report.Results[1].Bytes
+	require.NotNil(t, b)
+	assert.Equal(t, int64(4000), b.RequestBytes)
+	assert.Equal(t, int64(40), b.ResponseBytes)
+	assert.Equal(t, int64(3), b.RequestSize.Count)
+	assert.InDelta(t, 4000.0/3, b.RequestSize.Avg, 20)
+	assert.InDelta(t, 3000.0, b.RequestSize.Max, 30)
+	assert.Equal(t, 0.0, b.ResponseSize.Min)
+
+	// Over the time the results were collected in
+	elapsed := report.EndTime.Sub(report.StartTime)
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.InEpsilon(t, 4000/elapsed.Seconds(), b.RequestRate, 0.001)
+	assert.InEpsilon(t, 40/elapsed.Seconds(), b.ResponseRate, 0.001)
+
+	assert.Contains(t, out, "Throughput (MB, sizes in bytes):")
+
+	var csvOut bytes.Buffer
+	require.NoError(t, report.Write(&csvOut, FormatCSV, nil))
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	require.NoError(t, err)
+	row := map[string]string{}
+	for i, col := range rows[0] {
+		row[col] = rows[2][i]
+	}
+	assert.Equal(t, "4000", row["request_bytes"])
+	assert.Equal(t, "40", row["response_bytes"])
+
+	for _, r := range merged.Results {
+		if r.SubTarget == "/upload" {
+			require.NotNil(t, r.Bytes)
+			assert.Equal(t, int64(8000), r.Bytes.RequestBytes)
+			assert.Equal(t, int64(6), r.Bytes.ResponseSize.Count)
+		}
+	}
+}
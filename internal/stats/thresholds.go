@@ -0,0 +1,204 @@
+package stats
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Threshold is a limit on a metric of a result, ex: "p99<200ms" or
+// "errors<0.1%"
+type Threshold struct {
+	// p<percentile>, avg, min, max, errors or rps
+	Metric string
+	// <, <=, > or >=
+	Op string
+	// Latency in milliseconds, errors as a count (or a percentage of the
+	// requests if Percent is set), rps in requests per second
+	Value   float64
+	Percent bool
+
+	percentile float64
+	expr       string
+}
+
+var thresholdRe = regexp.MustCompile(`^\s*([a-z0-9.]+)\s*(<=|>=|<|>)\s*(\S+)\s*$`)
+
+// ParseThresholds parses comma separated thresholds, ex:
+// "p99<200ms,p50<=50,errors<0.1%,rps>=100". Latencies are durations or
+// milliseconds.
+func ParseThresholds(s string) ([]Threshold, error) {
+	thresholds := []Threshold{}
+	for _, v := range strings.Split(s, ",") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+
+		m := thresholdRe.FindStringSubmatch(strings.ToLower(v))
+		if m == nil {
+			return nil, fmt.Errorf("invalid threshold %q, expected <metric><op><value>, ex: p99<200ms", v)
+		}
+
+		t := Threshold{Metric: m[1], Op: m[2], expr: strings.TrimSpace(v)}
+		value := m[3]
+
+		switch {
+		case strings.HasPrefix(t.Metric, "p"):
+			p, err := strconv.ParseFloat(t.Metric[1:], 64)
+			if err != nil || p <= 0 || p > 100 {
+				return nil, fmt.Errorf("invalid threshold %q: bad percentile", v)
+			}
+			t.percentile = p
+			fallthrough
+		case t.Metric == "avg" || t.Metric == "min" || t.Metric == "max":
+			ms, err := parseMillis(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid threshold %q: %v", v, err)
+			}
+			t.Value = ms
+		case t.Metric == "errors":
+			if strings.HasSuffix(value, "%") {
+				t.Percent = true
+				value = strings.TrimSuffix(value, "%")
+			}
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid threshold %q: %v", v, err)
+			}
+			t.Value = f
+		case t.Metric == "rps":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid threshold %q: %v", v, err)
+			}
+			t.Value = f
+		default:
+			return nil, fmt.Errorf("invalid threshold %q: unknown metric %q, should be one of p<percentile>, avg, min, max, errors or rps", v, t.Metric)
+		}
+
+		thresholds = append(thresholds, t)
+	}
+
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("no thresholds in %q", s)
+	}
+
+	return thresholds, nil
+}
+
+func parseMillis(s string) (float64, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(d) / float64(time.Millisecond), nil
+}
+
+func (t Threshold) String() string {
+	return t.expr
+}
+
+// Observed gives the value of the threshold's metric in the result. Latency
+// is the one corrected for coordinated omission when available, as that is
+// what the clients would have seen.
+func (t Threshold) Observed(r *Result) float64 {
+	h := r.Histogram
+	snapshot := r.LatencySnapshot
+	if r.Corrected != nil {
+		h = *r.Corrected
+		snapshot = r.CorrectedSnapshot
+	}
+
+	actualScale := scale
+	if r.Type == string(RawTrace) {
+		actualScale = 1
+	}
+
+	switch t.Metric {
+	case "avg":
+		return h.Avg
+	case "min":
+		return h.Min
+	case "max":
+		return h.Max
+	case "errors":
+		errors := 0
+		if r.Errors != nil {
+			errors = *r.Errors
+		}
+		if !t.Percent {
+			return float64(errors)
+		}
+
+		// Failed requests with a latency are already in the histogram
+		// (and the failed one), the others (ex: connection refused)
+		// only in the errors
+		var failed int64
+		if r.Failed != nil {
+			failed = r.Failed.Count
+		}
+		total := r.Histogram.Count + max(int64(errors)-failed, 0)
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(errors) / float64(total)
+	case "rps":
+		return r.AvgRPS
+	}
+
+	// Percentile
+	if snapshot == nil {
+		return 0
+	}
+	return float64(hdrhistogram.Import(snapshot).ValueAtQuantile(t.percentile)) / actualScale
+}
+
+// Check tells whether the result is within the threshold, along with the
+// observed value
+func (t Threshold) Check(r *Result) (float64, bool) {
+	v := t.Observed(r)
+
+	switch t.Op {
+	case "<":
+		return v, v < t.Value
+	case "<=":
+		return v, v <= t.Value
+	case ">":
+		return v, v > t.Value
+	default:
+		return v, v >= t.Value
+	}
+}
+
+// Worse tells whether a is a worse value than b for the threshold, used to
+// report the worst value across results
+func (t Threshold) Worse(a, b float64) bool {
+	if t.Op == "<" || t.Op == "<=" {
+		return a > b
+	}
+
+	return a < b
+}
+
+// FormatValue formats an observed value in the threshold's unit
+func (t Threshold) FormatValue(v float64) string {
+	switch {
+	case t.Metric == "errors" && t.Percent:
+		return fmt.Sprintf("%.3f%%", v)
+	case t.Metric == "errors":
+		return fmt.Sprintf("%d", int64(v))
+	case t.Metric == "rps":
+		return fmt.Sprintf("%.2f", v)
+	}
+
+	return FormatLatency(v) + "ms"
+}
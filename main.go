@@ -7,6 +7,7 @@ import (
 	"syscall"
 
 	"github.com/freshworks/load-generator/cmd"
+	"github.com/freshworks/load-generator/internal/runner"
 )
 
 func main() {
@@ -15,8 +16,16 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		<-sigs
-		cancel()
+		// Runs in progress finish the requests in flight on the first
+		// interrupt, and stop right away on the next one. The one after
+		// that kills the process.
+		for range sigs {
+			if !runner.Interrupt() {
+				cancel()
+				signal.Stop(sigs)
+				return
+			}
+		}
 	}()
 
 	cmd.Execute(ctx)